@@ -0,0 +1,145 @@
+package webclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// ErrBatchAborted Запрос не выполнялся, т.к. другой запрос из DoAllFailFast завершился ошибкой
+var ErrBatchAborted = errors.New("webclient: batch aborted")
+
+// BatchResult Результат запроса из DoAll. Index - позиция запроса в переданном срезе
+type BatchResult struct {
+	Index    int
+	Response *http.Response
+	Body     string
+	Err      error
+}
+
+// DoAll Выполняет запросы, не более concurrency одновременно (0 - все сразу).
+// Результаты возвращаются в порядке запросов, ошибка каждого запроса - в BatchResult.Err
+func (w *Webclient) DoAll(reqs []*Request, concurrency int) []BatchResult {
+	return collectBatch(runBatch(reqs, concurrency, false), len(reqs))
+}
+
+// DoAllFailFast Выполняет запросы как DoAll, но при первой ошибке отменяет выполняющиеся запросы
+// и не запускает оставшиеся (их BatchResult.Err - ErrBatchAborted). Возвращает ошибку первого по порядку неудачного запроса
+func (w *Webclient) DoAllFailFast(reqs []*Request, concurrency int) ([]BatchResult, error) {
+	results := collectBatch(runBatch(reqs, concurrency, true), len(reqs))
+
+	var firstErr error
+	for _, result := range results {
+		if result.Err != nil && !errors.Is(result.Err, ErrBatchAborted) {
+			firstErr = result.Err
+			break
+		}
+	}
+
+	return results, firstErr
+}
+
+// DoAllStream Выполняет запросы как DoAll и отправляет результаты в канал по мере завершения.
+// Канал закрывается после выполнения всех запросов
+func (w *Webclient) DoAllStream(reqs []*Request, concurrency int) <-chan BatchResult {
+	return runBatch(reqs, concurrency, false)
+}
+
+// collectBatch Собирает результаты из канала в порядке запросов
+func collectBatch(results <-chan BatchResult, n int) []BatchResult {
+	ordered := make([]BatchResult, n)
+	for result := range results {
+		ordered[result.Index] = result
+	}
+
+	return ordered
+}
+
+// runBatch Запускает пул из concurrency горутин, выполняющих запросы. Канал результатов буферизован,
+// поэтому горутины завершаются, даже если результаты не читаются
+func runBatch(reqs []*Request, concurrency int, failFast bool) <-chan BatchResult {
+	if concurrency <= 0 || concurrency > len(reqs) {
+		concurrency = len(reqs)
+	}
+
+	results := make(chan BatchResult, len(reqs))
+	indexes := make(chan int, len(reqs))
+	for i := range reqs {
+		indexes <- i
+	}
+	close(indexes)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		aborted bool
+		cancels = make(map[int]context.CancelFunc)
+	)
+
+	// abort Отменяет выполняющиеся запросы после первой ошибки
+	abort := func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		aborted = true
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}
+
+	for n := 0; n < concurrency; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				req := reqs[i]
+
+				if failFast {
+					// Контекст отмены устанавливается в копии, чтобы не изменять запрос вызывающего
+					clone := *req
+					req = &clone
+
+					mu.Lock()
+					if aborted {
+						mu.Unlock()
+						results <- BatchResult{Index: i, Err: ErrBatchAborted}
+						continue
+					}
+
+					ctx, cancel := context.WithCancel(req.ctx)
+					req.ctx = ctx
+					cancels[i] = cancel
+					mu.Unlock()
+				}
+
+				resp, body, err := req.Do()
+
+				if failFast {
+					mu.Lock()
+					wasAborted := aborted
+					cancels[i]()
+					delete(cancels, i)
+					mu.Unlock()
+
+					if wasAborted && errors.Is(err, context.Canceled) {
+						// Запрос прерван из-за ошибки другого запроса
+						err = ErrBatchAborted
+					} else if err != nil {
+						abort()
+					}
+				}
+
+				results <- BatchResult{Index: i, Response: resp, Body: body, Err: err}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
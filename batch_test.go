@@ -0,0 +1,117 @@
+package webclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDoAll(t *testing.T) {
+	var inFlight, maxInFlight int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+
+		w.Write([]byte(r.URL.Query().Get("n")))
+	}))
+	defer ts.Close()
+
+	client := Config{}.New()
+
+	reqs := make([]*Request, 10)
+	for i := range reqs {
+		reqs[i] = client.Get(ts.URL).QueryParam("n", fmt.Sprint(i))
+	}
+	reqs = append(reqs, client.Get("http://127.0.0.1:1"))
+
+	results := client.DoAll(reqs, 3)
+	if len(results) != len(reqs) {
+		t.Fatalf("Expected: %d results, got: %d", len(reqs), len(results))
+	}
+
+	for i, result := range results[:10] {
+		if result.Index != i || result.Err != nil || result.Body != fmt.Sprint(i) {
+			t.Errorf("Expected: %d, got: %+v", i, result)
+		}
+	}
+
+	if results[10].Err == nil {
+		t.Errorf("Expected error for unreachable host")
+	}
+
+	if max := atomic.LoadInt32(&maxInFlight); max > 3 {
+		t.Errorf("Expected at most 3 requests in flight, got: %d", max)
+	}
+
+	reqs = make([]*Request, 5)
+	for i := range reqs {
+		reqs[i] = client.Get(ts.URL).QueryParam("n", fmt.Sprint(i))
+	}
+
+	received := 0
+	for result := range client.DoAllStream(reqs, 2) {
+		if result.Err != nil || result.Body != fmt.Sprint(result.Index) {
+			t.Errorf("Expected: %d, got: %+v", result.Index, result)
+		}
+		received++
+	}
+
+	if received != len(reqs) {
+		t.Errorf("Expected: %d results, got: %d", len(reqs), received)
+	}
+}
+
+func TestDoAllFailFast(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer ts.Close()
+
+	client := Config{}.New()
+
+	reqs := []*Request{
+		client.Get(ts.URL),
+		client.Get("http://127.0.0.1:1"),
+		client.Get(ts.URL),
+		client.Get(ts.URL),
+	}
+
+	start := time.Now()
+	results, err := client.DoAllFailFast(reqs, 2)
+	if err == nil {
+		t.Fatalf("Expected error for unreachable host")
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("In-flight requests should be canceled, elapsed: %v", elapsed)
+	}
+
+	for _, i := range []int{0, 2, 3} {
+		if !errors.Is(results[i].Err, ErrBatchAborted) {
+			t.Errorf("Request %d: expected error: %v, got: %v", i, ErrBatchAborted, results[i].Err)
+		}
+	}
+
+	// Отмена в пакете не должна затрагивать сами запросы
+	for i, req := range reqs {
+		if req.ctx.Err() != nil {
+			t.Errorf("Request %d: context should not be canceled, got: %v", i, req.ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package webclient
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrBulkheadFull Достигнут предел одновременных запросов (при BulkheadFailFast)
+var ErrBulkheadFull = errors.New("webclient: bulkhead is full")
+
+// QueueWaitHeader Заголовок ответа, в котором сообщается время ожидания в очереди bulkhead
+const QueueWaitHeader = "X-Webclient-Queue-Wait"
+
+// ResponseQueueWait Возвращает время, которое запрос провел в очереди bulkhead
+func ResponseQueueWait(resp *http.Response) time.Duration {
+	wait, _ := time.ParseDuration(resp.Header.Get(QueueWaitHeader))
+	return wait
+}
+
+// semaphore Ограничитель количества одновременно выполняемых запросов
+type semaphore chan struct{}
+
+// acquire Занимает слот. При failFast не ждет освобождения слота
+func (s semaphore) acquire(req *http.Request, failFast bool) error {
+	select {
+	case s <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if failFast {
+		return ErrBulkheadFull
+	}
+
+	select {
+	case s <- struct{}{}:
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
+
+// release Освобождает слот
+func (s semaphore) release() {
+	<-s
+}
+
+// bulkheadTransport http.RoundTripper, ограничивающий количество одновременно выполняемых запросов
+// глобально и к каждому хосту. Запрос занимает слот до закрытия тела ответа
+type bulkheadTransport struct {
+	next     http.RoundTripper
+	global   semaphore
+	perHost  int
+	failFast bool
+
+	mu    sync.Mutex
+	hosts map[string]semaphore
+}
+
+// newBulkheadTransport Оборачивает next в транспорт с ограничением одновременных запросов (0 - без ограничения)
+func newBulkheadTransport(next http.RoundTripper, maxConcurrent int, maxPerHost int, failFast bool) *bulkheadTransport {
+	t := &bulkheadTransport{
+		next:     next,
+		perHost:  maxPerHost,
+		failFast: failFast,
+		hosts:    make(map[string]semaphore),
+	}
+
+	if maxConcurrent > 0 {
+		t.global = make(semaphore, maxConcurrent)
+	}
+
+	return t
+}
+
+// RoundTrip Ожидает свободного слота и выполняет запрос
+func (t *bulkheadTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	acquired := make([]semaphore, 0, 2)
+
+	releaseAll := func() {
+		for _, s := range acquired {
+			s.release()
+		}
+	}
+
+	for _, s := range []semaphore{t.hostSemaphore(req.URL.Hostname()), t.global} {
+		if s == nil {
+			continue
+		}
+
+		if err := s.acquire(req, t.failFast); err != nil {
+			releaseAll()
+			return nil, err
+		}
+		acquired = append(acquired, s)
+	}
+
+	wait := time.Since(start)
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		releaseAll()
+		return nil, err
+	}
+
+	resp.Header.Set(QueueWaitHeader, wait.String())
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: releaseAll}
+
+	return resp, nil
+}
+
+// hostSemaphore Возвращает ограничитель хоста или nil, если ограничения нет
+func (t *bulkheadTransport) hostSemaphore(host string) semaphore {
+	if t.perHost <= 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.hosts[host]
+	if !ok {
+		s = make(semaphore, t.perHost)
+		t.hosts[host] = s
+	}
+
+	return s
+}
+
+// releaseBody Тело ответа, освобождающее слоты bulkhead при закрытии (один раз)
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+
+	return err
+}
@@ -0,0 +1,128 @@
+package webclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBulkhead(t *testing.T) {
+	var inFlight, maxInFlight int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+
+		time.Sleep(50 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+	}))
+	defer ts.Close()
+
+	cases := []struct {
+		name   string
+		config Config
+	}{
+		{"global", Config{MaxConcurrent: 2, UseKeepAlive: true}},
+		{"per-host", Config{MaxConcurrentPerHost: 2, UseKeepAlive: true}},
+	}
+
+	for _, c := range cases {
+		atomic.StoreInt32(&maxInFlight, 0)
+		client := c.config.New()
+
+		var (
+			wg     sync.WaitGroup
+			waited int32
+		)
+
+		for i := 0; i < 6; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				resp, _, err := client.Get(ts.URL).Do()
+				if err != nil {
+					t.Errorf("%s: got unexpected error: %v", c.name, err)
+					return
+				}
+
+				if ResponseQueueWait(resp) > 0 {
+					atomic.AddInt32(&waited, 1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if max := atomic.LoadInt32(&maxInFlight); max > 2 {
+			t.Errorf("%s: expected at most 2 requests in flight, got: %d", c.name, max)
+		}
+
+		if atomic.LoadInt32(&waited) == 0 {
+			t.Errorf("%s: expected queued requests to report wait time", c.name)
+		}
+	}
+}
+
+func TestBulkheadFailFast(t *testing.T) {
+	release := make(chan struct{})
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+
+	client := Config{MaxConcurrentPerHost: 1, BulkheadFailFast: true}.New()
+
+	done := make(chan struct{})
+	go func() {
+		client.Get(ts.URL).Do()
+		close(done)
+	}()
+
+	// Ждем, пока первый запрос займет место
+	time.Sleep(50 * time.Millisecond)
+
+	_, _, err := client.Get(ts.URL).Do()
+	if !errors.Is(err, ErrBulkheadFull) {
+		t.Errorf("Expected error: %v, got: %v", ErrBulkheadFull, err)
+	}
+
+	close(release)
+	<-done
+
+	if _, _, err := client.Get(ts.URL).Do(); err != nil {
+		t.Errorf("Slot should be released after response body is closed, got: %v", err)
+	}
+}
+
+func TestBulkheadContext(t *testing.T) {
+	release := make(chan struct{})
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	client := Config{MaxConcurrent: 1}.New()
+	go client.Get(ts.URL).Do()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, _, err := client.Get(ts.URL).WithContext(ctx).Do()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected error: %v, got: %v", context.DeadlineExceeded, err)
+	}
+}
@@ -0,0 +1,420 @@
+package webclient
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CacheStatus Статус ответа относительно кэша
+type CacheStatus string
+
+const (
+	// CacheMiss Ответ получен от сервера
+	CacheMiss CacheStatus = "MISS"
+	// CacheHit Ответ взят из кэша без обращения к серверу
+	CacheHit CacheStatus = "HIT"
+	// CacheRevalidated Ответ взят из кэша после подтверждения сервером (304 Not Modified)
+	CacheRevalidated CacheStatus = "REVALIDATED"
+)
+
+// CacheStatusHeader Заголовок ответа, в котором кэш сообщает CacheStatus
+const CacheStatusHeader = "X-Webclient-Cache"
+
+// maxCacheEntrySize Максимальный размер тела ответа, который сохраняется в кэш
+const maxCacheEntrySize = 10 << 20
+
+const (
+	// Служебные заголовки сохраненной записи: время сохранения и значения заголовков из Vary
+	cacheStoredAtHeader   = "X-Webclient-Stored-At"
+	cacheVaryHeaderPrefix = "X-Webclient-Vary-"
+)
+
+// ResponseCacheStatus Возвращает статус ответа относительно кэша.
+// Пустая строка означает, что кэш для запроса не использовался
+func ResponseCacheStatus(resp *http.Response) CacheStatus {
+	return CacheStatus(resp.Header.Get(CacheStatusHeader))
+}
+
+// cacheTransport http.RoundTripper, кэширующий ответы на GET запросы согласно Cache-Control, Expires и валидаторам (RFC 9111).
+// Хранилище общее для клиентов, созданных через With и NewSession, поэтому кэш ведет себя как разделяемый:
+// ответы с Cache-Control: private не сохраняются, для запросов с Authorization или Cookie
+// используются только ответы с Cache-Control: public, а Set-Cookie в запись не попадает
+type cacheTransport struct {
+	storage CacheStorage
+	next    http.RoundTripper
+}
+
+// newCacheTransport Оборачивает next в кэширующий транспорт
+func newCacheTransport(storage CacheStorage, next http.RoundTripper) *cacheTransport {
+	return &cacheTransport{storage: storage, next: next}
+}
+
+// RoundTrip Выполняет запрос, используя кэш
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := cacheKey(req)
+
+	if req.Method != http.MethodGet {
+		resp, err := t.next.RoundTrip(req)
+
+		// Успешный небезопасный запрос делает сохраненный ответ неактуальным
+		if err == nil && req.Method != http.MethodHead && req.Method != http.MethodOptions && resp.StatusCode < 400 {
+			t.storage.Delete(key)
+		}
+
+		return resp, err
+	}
+
+	reqControl := parseCacheControl(req.Header)
+	if _, ok := reqControl["no-store"]; ok || !cacheableRequest(req) {
+		return t.next.RoundTrip(req)
+	}
+
+	cached, storedAt := t.load(key, req)
+	if cached == nil {
+		return t.fetch(key, req)
+	}
+
+	// Ответ, сохраненный для анонимного запроса, может не подходить запросу с учетными данными
+	if !sharedCacheable(req, cached) {
+		cached.Body.Close()
+		return t.fetch(key, req)
+	}
+
+	if age, fresh := cacheFreshness(cached, storedAt, reqControl); fresh {
+		cached.Header.Set("Age", strconv.FormatInt(int64(age/time.Second), 10))
+		cached.Header.Set(CacheStatusHeader, string(CacheHit))
+		return cached, nil
+	}
+
+	etag := cached.Header.Get("ETag")
+	lastModified := cached.Header.Get("Last-Modified")
+	if len(etag) == 0 && len(lastModified) == 0 {
+		cached.Body.Close()
+		return t.fetch(key, req)
+	}
+
+	// Запись устарела -> проверяем ее актуальность условным запросом
+	creq := req.Clone(req.Context())
+	if len(etag) > 0 {
+		creq.Header.Set("If-None-Match", etag)
+	}
+	if len(lastModified) > 0 {
+		creq.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	resp, err := t.next.RoundTrip(creq)
+	if err != nil {
+		cached.Body.Close()
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusNotModified {
+		cached.Body.Close()
+		return t.store(key, req, resp), nil
+	}
+
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	// Обновляем сохраненные заголовки заголовками из 304 ответа
+	for name, values := range resp.Header {
+		if name == "Content-Length" || name == "Transfer-Encoding" {
+			continue
+		}
+		cached.Header[name] = values
+	}
+
+	cached = t.store(key, req, cached)
+	cached.Header.Set(CacheStatusHeader, string(CacheRevalidated))
+
+	return cached, nil
+}
+
+// fetch Выполняет запрос и сохраняет ответ, если он кэшируемый
+func (t *cacheTransport) fetch(key string, req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.store(key, req, resp), nil
+}
+
+// store Сохраняет ответ в хранилище, если он кэшируемый. Возвращает ответ с непрочитанным телом.
+// Тело копируется в запись по мере чтения и сохраняется, только если прочитано полностью и не больше maxCacheEntrySize
+func (t *cacheTransport) store(key string, req *http.Request, resp *http.Response) *http.Response {
+	resp.Header.Set(CacheStatusHeader, string(CacheMiss))
+
+	if !cacheableResponse(resp) || !sharedCacheable(req, resp) || resp.ContentLength > maxCacheEntrySize {
+		return resp
+	}
+
+	// Запись хранит копию заголовков со служебными заголовками.
+	// Время ожидания в очереди относится только к текущему ответу и в запись не попадает
+	snapshot := *resp
+	snapshot.Header = resp.Header.Clone()
+	snapshot.Header.Del(QueueWaitHeader)
+	snapshot.Header.Del(CacheStatusHeader)
+	// Куки предназначены только получателю ответа: из общего кэша они попали бы в чужие сессии
+	snapshot.Header.Del("Set-Cookie")
+	snapshot.Header.Set(cacheStoredAtHeader, strconv.FormatInt(time.Now().UnixNano(), 10))
+	for _, name := range varyHeaders(resp) {
+		snapshot.Header.Set(cacheVaryHeaderPrefix+name, req.Header.Get(name))
+	}
+
+	save := func(body []byte) {
+		snapshot.Body = ioutil.NopCloser(bytes.NewReader(body))
+		snapshot.ContentLength = int64(len(body))
+		snapshot.TransferEncoding = nil
+
+		if data, err := httputil.DumpResponse(&snapshot, true); err == nil {
+			t.storage.Set(key, data)
+		}
+	}
+
+	if resp.Body == nil || resp.Body == http.NoBody {
+		save(nil)
+		return resp
+	}
+
+	resp.Body = &cacheBody{ReadCloser: resp.Body, save: save}
+
+	return resp
+}
+
+// load Загружает сохраненный ответ, подходящий для запроса (с учетом Vary), и время его сохранения
+func (t *cacheTransport) load(key string, req *http.Request) (*http.Response, time.Time) {
+	data, ok := t.storage.Get(key)
+	if !ok {
+		return nil, time.Time{}
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), req)
+	if err != nil {
+		t.storage.Delete(key)
+		return nil, time.Time{}
+	}
+
+	for _, name := range varyHeaders(resp) {
+		if resp.Header.Get(cacheVaryHeaderPrefix+name) != req.Header.Get(name) {
+			resp.Body.Close()
+			return nil, time.Time{}
+		}
+	}
+
+	storedAt := time.Now()
+	if nano, err := strconv.ParseInt(resp.Header.Get(cacheStoredAtHeader), 10, 64); err == nil {
+		storedAt = time.Unix(0, nano)
+	}
+
+	stripCacheHeaders(resp)
+
+	return resp, storedAt
+}
+
+// cacheBody Тело ответа, которое при чтении копируется в буфер и сохраняется в кэш после чтения до конца.
+// Если тело больше maxCacheEntrySize или закрыто раньше, запись не сохраняется
+type cacheBody struct {
+	io.ReadCloser
+	save func(body []byte)
+
+	buf  bytes.Buffer
+	done bool
+}
+
+func (b *cacheBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+
+	if !b.done {
+		if b.buf.Len()+n > maxCacheEntrySize {
+			b.done = true
+			b.buf = bytes.Buffer{}
+		} else {
+			b.buf.Write(p[:n])
+		}
+
+		if err == io.EOF && !b.done {
+			b.done = true
+			b.save(b.buf.Bytes())
+			b.buf = bytes.Buffer{}
+		}
+	}
+
+	return n, err
+}
+
+func (b *cacheBody) Close() error {
+	b.done = true
+	return b.ReadCloser.Close()
+}
+
+// stripCacheHeaders Удаляет из ответа служебные заголовки сохраненной записи
+func stripCacheHeaders(resp *http.Response) {
+	for name := range resp.Header {
+		if strings.HasPrefix(name, cacheVaryHeaderPrefix) {
+			resp.Header.Del(name)
+		}
+	}
+
+	resp.Header.Del(cacheStoredAtHeader)
+}
+
+// cacheKey Ключ записи в кэше
+func cacheKey(req *http.Request) string {
+	return req.URL.String()
+}
+
+// cacheableRequest Можно ли использовать кэш для запроса.
+// Запросы с собственными условными заголовками или Range выполняются напрямую
+func cacheableRequest(req *http.Request) bool {
+	for _, name := range []string{"If-None-Match", "If-Modified-Since", "If-Match", "If-Unmodified-Since", "If-Range", "Range"} {
+		if len(req.Header.Get(name)) > 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// cacheableResponse Можно ли сохранить ответ в кэш
+func cacheableResponse(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusNoContent, http.StatusMultipleChoices,
+		http.StatusMovedPermanently, http.StatusPermanentRedirect, http.StatusNotFound, http.StatusGone:
+	default:
+		return false
+	}
+
+	if _, ok := parseCacheControl(resp.Header)["no-store"]; ok {
+		return false
+	}
+
+	for _, name := range varyHeaders(resp) {
+		if name == "*" {
+			return false
+		}
+	}
+
+	return freshnessLifetime(resp) > 0 || len(resp.Header.Get("ETag")) > 0 || len(resp.Header.Get("Last-Modified")) > 0
+}
+
+// sharedCacheable Можно ли хранить ответ в кэше, общем для разных клиентов и сессий (RFC 9111, 3.5):
+// ответ с private не сохраняется, ответ на запрос с учетными данными - только с public
+func sharedCacheable(req *http.Request, resp *http.Response) bool {
+	control := parseCacheControl(resp.Header)
+
+	if _, ok := control["private"]; ok {
+		return false
+	}
+
+	if len(req.Header.Get("Authorization")) > 0 || len(req.Header.Get("Cookie")) > 0 {
+		_, ok := control["public"]
+		return ok
+	}
+
+	return true
+}
+
+// cacheFreshness Возвращает возраст сохраненного ответа и признак того, что его можно отдать без проверки
+func cacheFreshness(resp *http.Response, storedAt time.Time, reqControl map[string]string) (time.Duration, bool) {
+	age := time.Since(storedAt)
+
+	if seconds, err := strconv.ParseInt(resp.Header.Get("Age"), 10, 64); err == nil && seconds > 0 {
+		age += time.Duration(seconds) * time.Second
+	}
+
+	if _, ok := reqControl["no-cache"]; ok {
+		return age, false
+	}
+
+	lifetime := freshnessLifetime(resp)
+	if maxAge, ok := reqControl["max-age"]; ok {
+		if seconds, err := strconv.ParseInt(maxAge, 10, 64); err == nil && time.Duration(seconds)*time.Second < lifetime {
+			lifetime = time.Duration(seconds) * time.Second
+		}
+	}
+
+	return age, age < lifetime
+}
+
+// freshnessLifetime Время, в течение которого ответ считается свежим:
+// max-age, затем Expires, затем эвристика 10% от возраста Last-Modified
+func freshnessLifetime(resp *http.Response) time.Duration {
+	control := parseCacheControl(resp.Header)
+
+	if _, ok := control["no-cache"]; ok {
+		return 0
+	}
+
+	if maxAge, ok := control["max-age"]; ok {
+		seconds, err := strconv.ParseInt(maxAge, 10, 64)
+		if err != nil || seconds <= 0 {
+			return 0
+		}
+
+		return time.Duration(seconds) * time.Second
+	}
+
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		date = time.Now()
+	}
+
+	if expiresHeader := resp.Header.Get("Expires"); len(expiresHeader) > 0 {
+		expires, err := http.ParseTime(expiresHeader)
+		if err != nil {
+			return 0
+		}
+
+		return expires.Sub(date)
+	}
+
+	if lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil && date.After(lastModified) {
+		return date.Sub(lastModified) / 10
+	}
+
+	return 0
+}
+
+// parseCacheControl Разбирает Cache-Control в map директива -> значение
+func parseCacheControl(header http.Header) map[string]string {
+	control := make(map[string]string)
+
+	for _, part := range strings.Split(header.Get("Cache-Control"), ",") {
+		part = strings.TrimSpace(part)
+		if len(part) == 0 {
+			continue
+		}
+
+		name, value := part, ""
+		if i := strings.Index(part, "="); i >= 0 {
+			name, value = part[:i], strings.Trim(part[i+1:], `"`)
+		}
+
+		control[strings.ToLower(strings.TrimSpace(name))] = value
+	}
+
+	return control
+}
+
+// varyHeaders Заголовки запроса, от которых зависит ответ (Vary)
+func varyHeaders(resp *http.Response) []string {
+	names := make([]string, 0)
+
+	for _, value := range resp.Header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); len(name) > 0 {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+
+	return names
+}
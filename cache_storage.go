@@ -0,0 +1,156 @@
+package webclient
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// CacheStorage Хранилище для кэша ответов. Реализации должны быть безопасны для конкурентного использования
+type CacheStorage interface {
+	// Get Возвращает сохраненные данные по ключу
+	Get(key string) ([]byte, bool)
+	// Set Сохраняет данные по ключу
+	Set(key string, data []byte)
+	// Delete Удаляет данные по ключу
+	Delete(key string)
+}
+
+// MemoryCache Хранилище кэша в памяти с вытеснением давно не использованных записей (LRU)
+type MemoryCache struct {
+	mu      sync.Mutex
+	maxSize int64
+	size    int64
+	items   map[string]*list.Element
+	lru     *list.List
+}
+
+type memoryCacheItem struct {
+	key  string
+	data []byte
+}
+
+// NewMemoryCache Создает хранилище кэша в памяти.
+// maxSize - максимальный суммарный размер записей в байтах, 0 - без ограничений
+func NewMemoryCache(maxSize int64) *MemoryCache {
+	return &MemoryCache{
+		maxSize: maxSize,
+		items:   make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Get Возвращает сохраненные данные по ключу
+func (c *MemoryCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	c.lru.MoveToFront(el)
+
+	return el.Value.(*memoryCacheItem).data, true
+}
+
+// Set Сохраняет данные по ключу, при превышении maxSize вытесняет давно не использованные записи
+func (c *MemoryCache) Set(key string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.maxSize > 0 && int64(len(data)) > c.maxSize {
+		c.remove(key)
+		return
+	}
+
+	if el, ok := c.items[key]; ok {
+		item := el.Value.(*memoryCacheItem)
+		c.size += int64(len(data)) - int64(len(item.data))
+		item.data = data
+		c.lru.MoveToFront(el)
+	} else {
+		c.items[key] = c.lru.PushFront(&memoryCacheItem{key: key, data: data})
+		c.size += int64(len(data))
+	}
+
+	for c.maxSize > 0 && c.size > c.maxSize {
+		c.remove(c.lru.Back().Value.(*memoryCacheItem).key)
+	}
+}
+
+// Delete Удаляет данные по ключу
+func (c *MemoryCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.remove(key)
+}
+
+func (c *MemoryCache) remove(key string) {
+	el, ok := c.items[key]
+	if !ok {
+		return
+	}
+
+	c.size -= int64(len(el.Value.(*memoryCacheItem).data))
+	c.lru.Remove(el)
+	delete(c.items, key)
+}
+
+// DiskCache Хранилище кэша на диске. Каждая запись хранится в отдельном файле
+type DiskCache struct {
+	dir string
+}
+
+// NewDiskCache Создает хранилище кэша в директории dir (создается при необходимости)
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &DiskCache{dir: dir}, nil
+}
+
+// Get Возвращает сохраненные данные по ключу
+func (c *DiskCache) Get(key string) ([]byte, bool) {
+	data, err := ioutil.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+
+	return data, true
+}
+
+// Set Сохраняет данные по ключу. Запись атомарна: данные пишутся во временный файл, который затем переименовывается
+func (c *DiskCache) Set(key string, data []byte) {
+	tmp, err := ioutil.TempFile(c.dir, ".tmp-")
+	if err != nil {
+		return
+	}
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil || os.Rename(tmp.Name(), c.path(key)) != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// Delete Удаляет данные по ключу
+func (c *DiskCache) Delete(key string) {
+	os.Remove(c.path(key))
+}
+
+// path Путь до файла записи. Имя файла - sha256 от ключа
+func (c *DiskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
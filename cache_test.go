@@ -0,0 +1,329 @@
+package webclient
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+	var calls int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+
+		switch r.URL.Path {
+		case "/fresh":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Write([]byte("fresh"))
+		case "/etag":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("ETag", `"v1"`)
+			w.Write([]byte("etag"))
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store")
+			w.Write([]byte("no-store"))
+		case "/vary":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Vary", "Accept-Language")
+			w.Write([]byte(r.Header.Get("Accept-Language")))
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	}))
+
+	defer ts.Close()
+
+	client := Config{Cache: NewMemoryCache(0)}.New()
+
+	cases := []struct {
+		path   string
+		method string
+		status CacheStatus
+		body   string
+		calls  int32
+	}{
+		{"/fresh", http.MethodGet, CacheMiss, "fresh", 1},
+		{"/fresh", http.MethodGet, CacheHit, "fresh", 1},
+		{"/etag", http.MethodGet, CacheMiss, "etag", 2},
+		{"/etag", http.MethodGet, CacheRevalidated, "etag", 3},
+		{"/no-store", http.MethodGet, CacheMiss, "no-store", 4},
+		{"/no-store", http.MethodGet, CacheMiss, "no-store", 5},
+		// Успешный POST сбрасывает сохраненный ответ
+		{"/fresh", http.MethodPost, "", "fresh", 6},
+		{"/fresh", http.MethodGet, CacheMiss, "fresh", 7},
+	}
+
+	for i, c := range cases {
+		var req *Request
+		if c.method == http.MethodPost {
+			req = client.Post(ts.URL + c.path)
+		} else {
+			req = client.Get(ts.URL + c.path)
+		}
+
+		resp, body, err := req.Do()
+		if err != nil {
+			t.Errorf("Case %d: got unexpected error: %v", i, err)
+			continue
+		}
+
+		if ResponseCacheStatus(resp) != c.status {
+			t.Errorf("Case %d: expected cache status: %s, got: %s", i, c.status, ResponseCacheStatus(resp))
+		}
+
+		if body != c.body {
+			t.Errorf("Case %d: expected body: %s, got: %s", i, c.body, body)
+		}
+
+		if atomic.LoadInt32(&calls) != c.calls {
+			t.Errorf("Case %d: expected calls to server: %d, got: %d", i, c.calls, atomic.LoadInt32(&calls))
+		}
+	}
+
+	_, body, _ := client.Get(ts.URL+"/vary").SetHeader("Accept-Language", "en").Do()
+	resp, body2, _ := client.Get(ts.URL+"/vary").SetHeader("Accept-Language", "ru").Do()
+	if body != "en" || body2 != "ru" || ResponseCacheStatus(resp) != CacheMiss {
+		t.Errorf("Vary should be respected, got: %s, %s (%s)", body, body2, ResponseCacheStatus(resp))
+	}
+}
+
+func TestCache_Credentials(t *testing.T) {
+	var calls int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+
+		switch r.URL.Path {
+		case "/private":
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		case "/public":
+			w.Header().Set("Cache-Control", "public, max-age=60")
+		default:
+			w.Header().Set("Cache-Control", "max-age=60")
+		}
+
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer ts.Close()
+
+	base := Config{Cache: NewMemoryCache(0)}.New()
+	alice := base.With(WithBearerToken("alice"))
+	bob := base.With(WithBearerToken("bob"))
+
+	cases := []struct {
+		client *Webclient
+		path   string
+		status CacheStatus
+		body   string
+		calls  int32
+	}{
+		// Ответ на запрос с учетными данными без public не сохраняется и не достается другому клиенту
+		{alice, "/user", CacheMiss, "Bearer alice", 1},
+		{bob, "/user", CacheMiss, "Bearer bob", 2},
+		{alice, "/user", CacheMiss, "Bearer alice", 3},
+		// private не сохраняется даже без учетных данных
+		{base, "/private", CacheMiss, "", 4},
+		{base, "/private", CacheMiss, "", 5},
+		// Анонимный ответ не отдается запросу с учетными данными
+		{base, "/user", CacheMiss, "", 6},
+		{base, "/user", CacheHit, "", 6},
+		{alice, "/user", CacheMiss, "Bearer alice", 7},
+		// public сохраняется и для запросов с учетными данными
+		{alice, "/public", CacheMiss, "Bearer alice", 8},
+		{bob, "/public", CacheHit, "Bearer alice", 8},
+	}
+
+	for i, c := range cases {
+		resp, body, err := c.client.Get(ts.URL + c.path).Do()
+		if err != nil {
+			t.Errorf("Case %d: got unexpected error: %v", i, err)
+			continue
+		}
+
+		if ResponseCacheStatus(resp) != c.status {
+			t.Errorf("Case %d: expected cache status: %s, got: %s", i, c.status, ResponseCacheStatus(resp))
+		}
+
+		if body != c.body {
+			t.Errorf("Case %d: expected body: %s, got: %s", i, c.body, body)
+		}
+
+		if atomic.LoadInt32(&calls) != c.calls {
+			t.Errorf("Case %d: expected calls to server: %d, got: %d", i, c.calls, atomic.LoadInt32(&calls))
+		}
+	}
+
+	// Куки сессии тоже считаются учетными данными
+	session := base.NewSession()
+	if err := session.Client().SetCookies(ts.URL, &http.Cookie{Name: "sid", Value: "1"}); err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	resp, _, err := session.Get(ts.URL + "/user").Do()
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	if ResponseCacheStatus(resp) != CacheMiss {
+		t.Errorf("Expected cache status: %s, got: %s", CacheMiss, ResponseCacheStatus(resp))
+	}
+}
+
+func TestCache_SetCookie(t *testing.T) {
+	var calls int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+
+		w.Header().Set("Cache-Control", "max-age=60")
+		http.SetCookie(w, &http.Cookie{Name: "sid", Value: "user" + strconv.Itoa(int(n)), Path: "/"})
+		w.Write([]byte("login"))
+	}))
+	defer ts.Close()
+
+	client := Config{Cache: NewMemoryCache(0)}.New()
+	first := client.NewSession()
+	second := client.NewSession()
+
+	if _, _, err := first.Get(ts.URL + "/login").Do(); err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	resp, body, err := second.Get(ts.URL + "/login").Do()
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	if ResponseCacheStatus(resp) != CacheHit || body != "login" {
+		t.Errorf("Expected: %s %s, got: %s %s", CacheHit, "login", ResponseCacheStatus(resp), body)
+	}
+
+	// Кука первой сессии не должна попасть во вторую через кэш
+	u, _ := url.Parse(ts.URL)
+	if cookies := second.Jar().Cookies(u); len(cookies) != 0 {
+		t.Errorf("Cached response should not set cookies, got: %v", cookies)
+	}
+
+	if cookies := first.Jar().Cookies(u); len(cookies) != 1 || cookies[0].Value != "user1" {
+		t.Errorf("Expected: %s, got: %v", "sid=user1", cookies)
+	}
+}
+
+func TestCache_EntrySize(t *testing.T) {
+	var calls int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+
+		w.Header().Set("Cache-Control", "max-age=60")
+		if r.URL.Path == "/chunked" {
+			// Без Content-Length размер становится известен только при чтении
+			w.Write(bytes.Repeat([]byte("a"), maxCacheEntrySize/2))
+			w.(http.Flusher).Flush()
+			w.Write(bytes.Repeat([]byte("a"), maxCacheEntrySize/2+1))
+			return
+		}
+
+		w.Write([]byte("small"))
+	}))
+	defer ts.Close()
+
+	client := Config{Cache: NewMemoryCache(0)}.New()
+
+	for i := 0; i < 2; i++ {
+		resp, body, err := client.Get(ts.URL + "/chunked").Do()
+		if err != nil {
+			t.Fatalf("Got unexpected error: %v", err)
+		}
+
+		if ResponseCacheStatus(resp) != CacheMiss || len(body) != maxCacheEntrySize+1 {
+			t.Errorf("Response larger than limit should not be cached, got: %s, %d bytes", ResponseCacheStatus(resp), len(body))
+		}
+	}
+
+	// Тело, закрытое до конца чтения, не сохраняется
+	resp, err := client.Get(ts.URL + "/small").Stream()
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	resp, body, err := client.Get(ts.URL + "/small").Do()
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	if ResponseCacheStatus(resp) != CacheMiss || body != "small" {
+		t.Errorf("Expected: %s %s, got: %s %s", CacheMiss, "small", ResponseCacheStatus(resp), body)
+	}
+
+	resp, body, err = client.Get(ts.URL + "/small").Do()
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	if ResponseCacheStatus(resp) != CacheHit || body != "small" {
+		t.Errorf("Expected: %s %s, got: %s %s", CacheHit, "small", ResponseCacheStatus(resp), body)
+	}
+
+	if n := atomic.LoadInt32(&calls); n != 4 {
+		t.Errorf("Expected calls to server: %d, got: %d", 4, n)
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	c := NewMemoryCache(10)
+	c.Set("a", []byte("12345"))
+	c.Set("b", []byte("12345"))
+	c.Get("a")
+	c.Set("c", []byte("12345"))
+
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("Least recently used entry should be evicted")
+	}
+
+	if _, ok := c.Get("a"); !ok {
+		t.Errorf("Recently used entry should be kept")
+	}
+
+	c.Set("big", []byte("12345678901"))
+	if _, ok := c.Get("big"); ok {
+		t.Errorf("Entry larger than cache should not be stored")
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webclient")
+	if err != nil {
+		t.Fatalf("Cant create temp dir: %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	c, err := NewDiskCache(dir)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	c.Set("http://example.com/", []byte("data"))
+	if d, ok := c.Get("http://example.com/"); !ok || string(d) != "data" {
+		t.Errorf("Expected: %s, got: %s", "data", string(d))
+	}
+
+	c.Delete("http://example.com/")
+	if _, ok := c.Get("http://example.com/"); ok {
+		t.Errorf("Entry should be deleted")
+	}
+}
@@ -0,0 +1,271 @@
+package webclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen Запросы к хосту временно не выполняются: circuit breaker разомкнут
+var ErrCircuitOpen = errors.New("webclient: circuit breaker is open")
+
+// CircuitState Состояние circuit breaker хоста
+type CircuitState int
+
+const (
+	// CircuitClosed Запросы выполняются, неудачи подсчитываются
+	CircuitClosed CircuitState = iota
+	// CircuitOpen Запросы сразу завершаются ErrCircuitOpen
+	CircuitOpen
+	// CircuitHalfOpen Выполняется ограниченное число пробных запросов
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// CircuitBreaker Настройки circuit breaker, работающего отдельно для каждого хоста.
+// Нулевое значение - circuit breaker не используется
+type CircuitBreaker struct {
+	// Доля неудачных запросов (0..1], при достижении которой запросы к хосту прекращаются.
+	// Неудачей считается ошибка транспорта или ответ со статусом 5xx
+	FailureRatio float64
+	// Минимальное количество запросов, после которого учитывается FailureRatio. По умолчанию 10
+	MinRequests int
+	// Период подсчета запросов в замкнутом состоянии. По умолчанию 1 минута
+	Interval time.Duration
+	// Время, на которое запросы к хосту прекращаются. По умолчанию 30 секунд
+	OpenTimeout time.Duration
+	// Количество пробных запросов после OpenTimeout. Если все они успешны, запросы возобновляются. По умолчанию 1
+	HalfOpenRequests int
+	// Вызывается при смене состояния хоста
+	OnStateChange func(host string, from CircuitState, to CircuitState)
+}
+
+// enabled Задан ли circuit breaker
+func (c CircuitBreaker) enabled() bool {
+	return c.FailureRatio > 0
+}
+
+// withDefaults Возвращает настройки со значениями по умолчанию вместо незаданных
+func (c CircuitBreaker) withDefaults() CircuitBreaker {
+	if c.MinRequests <= 0 {
+		c.MinRequests = 10
+	}
+	if c.Interval <= 0 {
+		c.Interval = time.Minute
+	}
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = 30 * time.Second
+	}
+	if c.HalfOpenRequests <= 0 {
+		c.HalfOpenRequests = 1
+	}
+
+	return c
+}
+
+// circuit Состояние circuit breaker одного хоста. generation меняется при каждой смене состояния,
+// чтобы результаты запросов, начатых в прошлом состоянии, не учитывались
+type circuit struct {
+	state      CircuitState
+	generation uint64
+	requests   int
+	failures   int
+	successes  int
+	inFlight   int
+	expiry     time.Time
+}
+
+// circuitTransition Смена состояния хоста, о которой нужно сообщить в OnStateChange
+type circuitTransition struct {
+	host string
+	from CircuitState
+	to   CircuitState
+}
+
+// circuitBreaker http.RoundTripper, прекращающий запросы к хостам, которые отвечают ошибками
+type circuitBreaker struct {
+	next     http.RoundTripper
+	settings CircuitBreaker
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+// newCircuitBreaker Оборачивает next в circuit breaker
+func newCircuitBreaker(next http.RoundTripper, settings CircuitBreaker) *circuitBreaker {
+	return &circuitBreaker{
+		next:     next,
+		settings: settings.withDefaults(),
+		circuits: make(map[string]*circuit),
+	}
+}
+
+// RoundTrip Выполняет запрос, если circuit breaker хоста это разрешает
+func (b *circuitBreaker) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Hostname()
+
+	generation, err := b.before(host)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := b.next.RoundTrip(req)
+
+	switch {
+	case err != nil && (req.Context().Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, ErrBulkheadFull)):
+		// Отмена запроса и отказ bulkhead ничего не говорят о состоянии хоста
+		b.after(host, generation, false, true)
+	case err != nil || resp.StatusCode >= 500:
+		b.after(host, generation, false, false)
+	default:
+		b.after(host, generation, true, false)
+	}
+
+	return resp, err
+}
+
+// State Возвращает текущее состояние хоста
+func (b *circuitBreaker) State(host string) CircuitState {
+	b.mu.Lock()
+
+	c, ok := b.circuits[host]
+	if !ok {
+		b.mu.Unlock()
+		return CircuitClosed
+	}
+
+	// Переход open -> half-open по таймеру тоже сообщается в OnStateChange
+	transitions := b.update(host, c, time.Now())
+	state := c.state
+
+	b.mu.Unlock()
+	b.notify(transitions)
+
+	return state
+}
+
+// before Проверяет, можно ли выполнить запрос к хосту, и возвращает поколение состояния
+func (b *circuitBreaker) before(host string) (uint64, error) {
+	b.mu.Lock()
+
+	c, ok := b.circuits[host]
+	if !ok {
+		c = &circuit{expiry: time.Now().Add(b.settings.Interval)}
+		b.circuits[host] = c
+	}
+
+	transitions := b.update(host, c, time.Now())
+
+	var err error
+	switch {
+	case c.state == CircuitOpen:
+		err = fmt.Errorf("%w: %s", ErrCircuitOpen, host)
+	case c.state == CircuitHalfOpen && c.inFlight >= b.settings.HalfOpenRequests:
+		err = fmt.Errorf("%w: %s", ErrCircuitOpen, host)
+	default:
+		c.requests++
+		c.inFlight++
+	}
+	generation := c.generation
+
+	b.mu.Unlock()
+	b.notify(transitions)
+
+	return generation, err
+}
+
+// after Учитывает результат запроса. ignored - запрос не учитывается ни как успех, ни как неудача
+func (b *circuitBreaker) after(host string, generation uint64, success bool, ignored bool) {
+	b.mu.Lock()
+
+	c := b.circuits[host]
+	transitions := b.update(host, c, time.Now())
+
+	if c.generation == generation {
+		c.inFlight--
+
+		switch {
+		case ignored:
+			c.requests--
+		case c.state == CircuitHalfOpen && !success:
+			transitions = append(transitions, b.setState(host, c, CircuitOpen, time.Now()))
+		case c.state == CircuitHalfOpen:
+			c.successes++
+			if c.successes >= b.settings.HalfOpenRequests {
+				transitions = append(transitions, b.setState(host, c, CircuitClosed, time.Now()))
+			}
+		case !success:
+			c.failures++
+			if c.requests >= b.settings.MinRequests &&
+				float64(c.failures)/float64(c.requests) >= b.settings.FailureRatio {
+				transitions = append(transitions, b.setState(host, c, CircuitOpen, time.Now()))
+			}
+		}
+	}
+
+	b.mu.Unlock()
+	b.notify(transitions)
+}
+
+// update Переводит хост в half-open по истечении OpenTimeout и сбрасывает счетчики по истечении Interval
+func (b *circuitBreaker) update(host string, c *circuit, now time.Time) []circuitTransition {
+	// В half-open состояние меняется только по результатам пробных запросов
+	if c.state == CircuitHalfOpen || now.Before(c.expiry) {
+		return nil
+	}
+
+	switch c.state {
+	case CircuitOpen:
+		return []circuitTransition{b.setState(host, c, CircuitHalfOpen, now)}
+	case CircuitClosed:
+		c.generation++
+		c.requests, c.failures, c.inFlight = 0, 0, 0
+		c.expiry = now.Add(b.settings.Interval)
+	}
+
+	return nil
+}
+
+// setState Меняет состояние хоста и сбрасывает счетчики
+func (b *circuitBreaker) setState(host string, c *circuit, state CircuitState, now time.Time) circuitTransition {
+	transition := circuitTransition{host: host, from: c.state, to: state}
+
+	c.state = state
+	c.generation++
+	c.requests, c.failures, c.successes, c.inFlight = 0, 0, 0, 0
+
+	switch state {
+	case CircuitOpen:
+		c.expiry = now.Add(b.settings.OpenTimeout)
+	case CircuitClosed:
+		c.expiry = now.Add(b.settings.Interval)
+	}
+
+	return transition
+}
+
+// notify Сообщает о смене состояний в OnStateChange (вне блокировки)
+func (b *circuitBreaker) notify(transitions []circuitTransition) {
+	if b.settings.OnStateChange == nil {
+		return
+	}
+
+	for _, t := range transitions {
+		b.settings.OnStateChange(t.host, t.from, t.to)
+	}
+}
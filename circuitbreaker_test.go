@@ -0,0 +1,124 @@
+package webclient
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var (
+		failing int32 = 1
+		calls   int32
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer ts.Close()
+
+	var (
+		mu          sync.Mutex
+		transitions []string
+	)
+
+	client := Config{CircuitBreaker: CircuitBreaker{
+		FailureRatio: 0.5,
+		MinRequests:  4,
+		OpenTimeout:  100 * time.Millisecond,
+		OnStateChange: func(host string, from CircuitState, to CircuitState) {
+			mu.Lock()
+			transitions = append(transitions, from.String()+"->"+to.String())
+			mu.Unlock()
+		},
+	}}.New()
+
+	for i := 0; i < 4; i++ {
+		if _, _, err := client.Get(ts.URL).Do(); err != nil {
+			t.Errorf("Got unexpected error: %v", err)
+		}
+	}
+
+	if state := client.CircuitState("127.0.0.1"); state != CircuitOpen {
+		t.Errorf("Expected: %s, got: %s", CircuitOpen, state)
+	}
+
+	_, _, err := client.Get(ts.URL).Do()
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected error: %v, got: %v", ErrCircuitOpen, err)
+	}
+
+	if n := atomic.LoadInt32(&calls); n != 4 {
+		t.Errorf("Open circuit should not send requests, expected: 4, got: %d", n)
+	}
+
+	// Пробный запрос после OpenTimeout неудачен -> снова open
+	time.Sleep(150 * time.Millisecond)
+	client.Get(ts.URL).Do()
+
+	if state := client.CircuitState("127.0.0.1"); state != CircuitOpen {
+		t.Errorf("Expected: %s, got: %s", CircuitOpen, state)
+	}
+
+	// Пробный запрос успешен -> closed
+	atomic.StoreInt32(&failing, 0)
+	time.Sleep(150 * time.Millisecond)
+
+	if _, _, err := client.Get(ts.URL).Do(); err != nil {
+		t.Errorf("Got unexpected error: %v", err)
+	}
+
+	if state := client.CircuitState("127.0.0.1"); state != CircuitClosed {
+		t.Errorf("Expected: %s, got: %s", CircuitClosed, state)
+	}
+
+	expected := []string{"closed->open", "open->half-open", "half-open->open", "open->half-open", "half-open->closed"}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(transitions) != len(expected) {
+		t.Fatalf("Expected: %v, got: %v", expected, transitions)
+	}
+
+	for i := range expected {
+		if transitions[i] != expected[i] {
+			t.Errorf("Expected: %v, got: %v", expected, transitions)
+			break
+		}
+	}
+}
+
+func TestCircuitBreakerMinRequests(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	client := Config{CircuitBreaker: CircuitBreaker{FailureRatio: 1, MinRequests: 5}}.New()
+
+	for i := 0; i < 4; i++ {
+		client.Get(ts.URL).Do()
+	}
+
+	if state := client.CircuitState("127.0.0.1"); state != CircuitClosed {
+		t.Errorf("Circuit should stay closed until MinRequests, got: %s", state)
+	}
+
+	client.Get(ts.URL).Do()
+
+	if state := client.CircuitState("127.0.0.1"); state != CircuitOpen {
+		t.Errorf("Expected: %s, got: %s", CircuitOpen, state)
+	}
+
+	if state := client.CircuitState("example.com"); state != CircuitClosed {
+		t.Errorf("Other hosts should not be affected, got: %s", state)
+	}
+}
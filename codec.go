@@ -0,0 +1,112 @@
+package webclient
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+	"sync"
+)
+
+// ErrCodecNotFound Для Content-Type не зарегистрирован кодек
+var ErrCodecNotFound = errors.New("webclient: codec not found")
+
+// Codec Кодек для сериализации структур в тело запроса (SendStruct) и разбора тела ответа (Result)
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// funcCodec Codec из пары функций
+type funcCodec struct {
+	marshal   func(interface{}) ([]byte, error)
+	unmarshal func([]byte, interface{}) error
+}
+
+func (c funcCodec) Marshal(v interface{}) ([]byte, error) {
+	return c.marshal(v)
+}
+
+func (c funcCodec) Unmarshal(data []byte, v interface{}) error {
+	return c.unmarshal(data, v)
+}
+
+// NewCodec Создает Codec из пары функций, например NewCodec(yaml.Marshal, yaml.Unmarshal)
+func NewCodec(marshal func(interface{}) ([]byte, error), unmarshal func([]byte, interface{}) error) Codec {
+	return funcCodec{marshal: marshal, unmarshal: unmarshal}
+}
+
+var codecs = struct {
+	sync.RWMutex
+	m map[WContentType]Codec
+}{
+	m: map[WContentType]Codec{
+		TypeJSON:   NewCodec(json.Marshal, json.Unmarshal),
+		TypeXML:    NewCodec(xml.Marshal, xml.Unmarshal),
+		"text/xml": NewCodec(xml.Marshal, xml.Unmarshal),
+	},
+}
+
+// RegisterCodec Регистрирует кодек для Content-Type. Уже зарегистрированный кодек будет заменен.
+// Кодеки для JSON и XML зарегистрированы по умолчанию
+func RegisterCodec(ctype WContentType, codec Codec) {
+	codecs.Lock()
+	defer codecs.Unlock()
+
+	codecs.m[normalizeContentType(string(ctype))] = codec
+}
+
+// lookupCodec Ищет кодек для Content-Type и значения v. Параметры (charset и т.п.) игнорируются,
+// для типов с суффиксом (application/problem+json) используется кодек базового формата.
+// Для ProtoMessage используются только кодеки из RegisterProtoCodec: обычные кодеки (например, encoding/json)
+// не соблюдают правила сериализации protobuf
+func lookupCodec(ctype string, v interface{}) (Codec, error) {
+	mediaType := normalizeContentType(ctype)
+
+	if _, ok := v.(ProtoMessage); ok {
+		protoCodecs.RLock()
+		codec, ok := findCodec(protoCodecs.m, mediaType)
+		protoCodecs.RUnlock()
+
+		if !ok {
+			return nil, fmt.Errorf("%w: %s for %T, use RegisterProtoCodec", ErrCodecNotFound, ctype, v)
+		}
+
+		return codec, nil
+	}
+
+	codecs.RLock()
+	defer codecs.RUnlock()
+
+	if codec, ok := findCodec(codecs.m, mediaType); ok {
+		return codec, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrCodecNotFound, ctype)
+}
+
+// findCodec Ищет кодек по точному совпадению, а затем по суффиксу типа
+func findCodec(m map[WContentType]Codec, mediaType WContentType) (Codec, bool) {
+	if codec, ok := m[mediaType]; ok {
+		return codec, true
+	}
+
+	if i := strings.LastIndex(string(mediaType), "+"); i >= 0 {
+		if codec, ok := m[WContentType("application/"+string(mediaType)[i+1:])]; ok {
+			return codec, true
+		}
+	}
+
+	return nil, false
+}
+
+// normalizeContentType Отбрасывает параметры Content-Type и приводит его к нижнему регистру
+func normalizeContentType(ctype string) WContentType {
+	if mediaType, _, err := mime.ParseMediaType(ctype); err == nil {
+		return WContentType(mediaType)
+	}
+
+	return WContentType(strings.ToLower(strings.TrimSpace(ctype)))
+}
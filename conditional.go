@@ -0,0 +1,77 @@
+package webclient
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+var (
+	// ErrNotModified Сервер ответил 304 Not Modified на условный запрос
+	ErrNotModified = errors.New("webclient: not modified")
+	// ErrPreconditionFailed Сервер ответил 412 Precondition Failed на условный запрос
+	ErrPreconditionFailed = errors.New("webclient: precondition failed")
+)
+
+// conditionalHeaders Заголовки, делающие запрос условным
+var conditionalHeaders = []string{"If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"}
+
+// IfMatch Устанавливает заголовок If-Match. Используется для оптимистичной блокировки:
+// запрос будет выполнен, только если ETag ресурса не изменился, иначе Do вернет ErrPreconditionFailed
+func (r *Request) IfMatch(etag string) *Request {
+	r.headers["If-Match"] = etag
+	return r
+}
+
+// IfNoneMatch Устанавливает заголовок If-None-Match. Если ETag ресурса совпадает, Do вернет ErrNotModified
+func (r *Request) IfNoneMatch(etag string) *Request {
+	r.headers["If-None-Match"] = etag
+	return r
+}
+
+// IfModifiedSince Устанавливает заголовок If-Modified-Since. Если ресурс не изменялся, Do вернет ErrNotModified
+func (r *Request) IfModifiedSince(t time.Time) *Request {
+	r.headers["If-Modified-Since"] = t.UTC().Format(http.TimeFormat)
+	return r
+}
+
+// IfUnmodifiedSince Устанавливает заголовок If-Unmodified-Since.
+// Если ресурс изменялся после t, Do вернет ErrPreconditionFailed
+func (r *Request) IfUnmodifiedSince(t time.Time) *Request {
+	r.headers["If-Unmodified-Since"] = t.UTC().Format(http.TimeFormat)
+	return r
+}
+
+// ResponseETag Возвращает ETag ответа (в кавычках, как его нужно передать в IfMatch/IfNoneMatch)
+func ResponseETag(resp *http.Response) string {
+	return resp.Header.Get("ETag")
+}
+
+// ResponseLastModified Возвращает время из заголовка Last-Modified ответа
+func ResponseLastModified(resp *http.Response) (time.Time, error) {
+	return http.ParseTime(resp.Header.Get("Last-Modified"))
+}
+
+// conditionalError Возвращает ErrNotModified или ErrPreconditionFailed для ответа на условный запрос
+func conditionalError(req *http.Request, resp *http.Response) error {
+	conditional := false
+	for _, name := range conditionalHeaders {
+		if len(req.Header.Get(name)) > 0 {
+			conditional = true
+			break
+		}
+	}
+
+	if !conditional {
+		return nil
+	}
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return ErrNotModified
+	case http.StatusPreconditionFailed:
+		return ErrPreconditionFailed
+	}
+
+	return nil
+}
@@ -2,7 +2,6 @@ package webclient
 
 import (
 	"crypto/tls"
-	"net"
 
 	//"net"
 	"net/http"
@@ -15,41 +14,141 @@ type Config struct {
 	Timeout        time.Duration
 	UseKeepAlive   bool
 	FollowRedirect bool
+	// Хранилище для кэша GET ответов (NewMemoryCache, NewDiskCache). Если не указано, кэш не используется
+	Cache CacheStorage
+	// Ограничение частоты всех запросов клиента
+	RateLimit RateLimit
+	// Ограничение частоты запросов к каждому хосту в отдельности
+	PerHostRateLimit RateLimit
+	// Ограничения частоты для конкретных хостов (ключ - имя хоста без порта), имеют приоритет над PerHostRateLimit
+	HostRateLimits map[string]RateLimit
+	// Замедлять или приостанавливать запросы к хосту по заголовкам X-RateLimit-*, RateLimit-* и Retry-After
+	AdaptiveRateLimit bool
+	// Вызывается, когда запросы к хосту начинают замедляться по заголовкам сервера
+	OnThrottle func(Throttle)
+	// Максимальное количество одновременно выполняемых запросов клиента (0 - без ограничения).
+	// Запрос занимает место до закрытия тела ответа. Не зависит от ограничений соединений http.Transport
+	MaxConcurrent int
+	// Максимальное количество одновременно выполняемых запросов к каждому хосту (0 - без ограничения)
+	MaxConcurrentPerHost int
+	// Не ждать освобождения места, а сразу возвращать ErrBulkheadFull
+	BulkheadFailFast bool
+	// Прекращать запросы к хосту, который отвечает ошибками (Request.Do сразу вернет ErrCircuitOpen)
+	CircuitBreaker CircuitBreaker
+	// Список публичных суффиксов для хранилища кук (например, publicsuffix.List из golang.org/x/net/publicsuffix)
+	PublicSuffixList cookiejar.PublicSuffixList
+	// Не сохранять куки из ответов
+	DisableCookieJar bool
+	// Хранилище кук вместо создаваемого по умолчанию (например, Jar, загруженный через LoadFile)
+	CookieJar http.CookieJar
 }
 
-// New Создает и возвращает *Webclient
-func (c Config) New() *Webclient {
-	options := cookiejar.Options{}
-	jar, _ := cookiejar.New(&options)
-
+// New Создает *Webclient с настройками по умолчанию и применяет к нему opts.
+// По умолчанию сертификаты проверяются, соединения переиспользуются, редиректы выполняются,
+// а куки сохраняются в Jar
+func New(opts ...Option) *Webclient {
 	newWebClient := &Webclient{
-		client: &http.Client{Jar: jar},
+		client:  &http.Client{Jar: NewJar(nil)},
+		proxies: &proxyTransports{transports: make(map[proxyTransportKey]*http.Transport)},
 		transport: &http.Transport{
-			Proxy:              nil,
-			TLSClientConfig:    &tls.Config{InsecureSkipVerify: true},
-			DisableCompression: false,
-			DisableKeepAlives:  !c.UseKeepAlive,
-
+			// Распаковка ответов выполняется в Request.Do, в т.ч. для кодировок из RegisterDecoder
+			DisableCompression: true,
 		},
 	}
 
+	for _, opt := range opts {
+		opt(newWebClient)
+	}
+
+	newWebClient.config.wrapTransport(newWebClient)
+
+	return newWebClient
+}
+
+// New Создает и возвращает *Webclient. Поля Config применяются теми же опциями, что и в New
+func (c Config) New() *Webclient {
+	return New(c.options()...)
+}
+
+// options Опции, соответствующие полям Config
+func (c Config) options() []Option {
+	opts := []Option{
+		WithTLS(&tls.Config{InsecureSkipVerify: true}),
+		WithKeepAlive(c.UseKeepAlive),
+		WithFollowRedirect(c.FollowRedirect),
+		WithCache(c.Cache),
+		WithRateLimit(c.RateLimit),
+		WithPerHostRateLimit(c.PerHostRateLimit),
+		WithMaxConcurrent(c.MaxConcurrent),
+		WithMaxConcurrentPerHost(c.MaxConcurrentPerHost),
+		WithBulkheadFailFast(c.BulkheadFailFast),
+		WithCircuitBreaker(c.CircuitBreaker),
+	}
+
+	if c.DisableCookieJar {
+		opts = append(opts, WithCookieJar(nil))
+	} else if c.CookieJar != nil {
+		opts = append(opts, WithCookieJar(c.CookieJar))
+	} else if c.PublicSuffixList != nil {
+		opts = append(opts, WithCookieJar(NewJar(c.PublicSuffixList)))
+	}
+
 	if c.Timeout > 0 {
-		newWebClient.client.Timeout = c.Timeout
-		newWebClient.transport.TLSHandshakeTimeout = c.Timeout
-		newWebClient.transport.ResponseHeaderTimeout = c.Timeout
-		newWebClient.transport.DialContext = (&net.Dialer{
-			Timeout:   c.Timeout,
-			KeepAlive: 120 * time.Second,
-		}).DialContext
-	}
-
-	if !c.FollowRedirect {
-		newWebClient.client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
+		opts = append(opts, WithTimeout(c.Timeout), withTransportTimeout(c.Timeout))
+	}
+
+	for host, limit := range c.HostRateLimits {
+		opts = append(opts, WithHostRateLimit(host, limit))
+	}
+
+	if c.AdaptiveRateLimit {
+		opts = append(opts, WithAdaptiveRateLimit(c.OnThrottle))
+	}
+
+	return opts
+}
+
+// wrapTransport Строит цепочку транспортов поверх w.transport и устанавливает ее клиенту.
+// Клиенты, созданные через With с другим транспортом, используют эту же цепочку (см. Webclient.setTransport).
+// Цепочка: кэш -> circuit breaker -> ограничение частоты -> ограничение одновременных запросов -> http.Transport.
+// Ответы из кэша не расходуют лимит запросов, а при разомкнутом circuit breaker запрос не ждет в очередях
+func (c Config) wrapTransport(w *Webclient) {
+	var roundTripper http.RoundTripper = &baseTransport{fallback: w.transport}
+	layers := false
+
+	if c.MaxConcurrent > 0 || c.MaxConcurrentPerHost > 0 {
+		roundTripper = newBulkheadTransport(roundTripper, c.MaxConcurrent, c.MaxConcurrentPerHost, c.BulkheadFailFast)
+		layers = true
+	}
+
+	if c.RateLimit.enabled() || c.PerHostRateLimit.enabled() || len(c.HostRateLimits) > 0 || c.AdaptiveRateLimit {
+		limiter := newRateLimitTransport(roundTripper, c.RateLimit, c.PerHostRateLimit, c.HostRateLimits)
+		if c.AdaptiveRateLimit {
+			limiter.adaptive = newAdaptiveLimiter(c.OnThrottle)
 		}
-	} else {
-		newWebClient.client.CheckRedirect = nil
+		roundTripper = limiter
+		layers = true
 	}
 
-	return newWebClient
+	w.breaker = nil
+	if c.CircuitBreaker.enabled() {
+		w.breaker = newCircuitBreaker(roundTripper, c.CircuitBreaker)
+		roundTripper = w.breaker
+		layers = true
+	}
+
+	if c.Cache != nil {
+		roundTripper = newCacheTransport(c.Cache, roundTripper)
+		layers = true
+	}
+
+	// Без ограничений и кэша цепочка не нужна
+	if !layers {
+		w.chain = nil
+		w.client.Transport = w.transport
+		return
+	}
+
+	w.chain = roundTripper
+	w.client.Transport = roundTripper
 }
@@ -3,10 +3,15 @@ package webclient
 type WContentType string
 
 const (
-	TypeHTML       WContentType = "text/html"
-	TypeJSON       WContentType = "application/json"
-	TypeXML        WContentType = "application/xml"
-	TypeText       WContentType = "text/plain"
-	TypeForm       WContentType = "application/x-www-form-urlencoded"
-	TypeMultipart  WContentType = "multipart/form-data"
+	TypeHTML        WContentType = "text/html"
+	TypeJSON        WContentType = "application/json"
+	TypeXML         WContentType = "application/xml"
+	TypeText        WContentType = "text/plain"
+	TypeForm        WContentType = "application/x-www-form-urlencoded"
+	TypeMultipart   WContentType = "multipart/form-data"
+	TypeOctetStream WContentType = "application/octet-stream"
+	TypeYAML        WContentType = "application/yaml"
+	TypeMsgPack     WContentType = "application/msgpack"
+	TypeCBOR        WContentType = "application/cbor"
+	TypeProtobuf    WContentType = "application/x-protobuf"
 )
@@ -0,0 +1,155 @@
+package webclient
+
+import (
+	"errors"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNoCookieJar У клиента отключено хранилище кук
+	ErrNoCookieJar = errors.New("webclient: cookie jar is disabled")
+	// ErrJarNotClearable Хранилище кук клиента не поддерживает очистку (метод Clear)
+	ErrJarNotClearable = errors.New("webclient: cookie jar can not be cleared")
+)
+
+// Jar Хранилище кук на основе cookiejar.Jar с возможностью очистки, сохранения на диск и загрузки (см. Save, Load)
+type Jar struct {
+	mu      sync.RWMutex
+	options cookiejar.Options
+	jar     *cookiejar.Jar
+	// Принятые куки для сохранения (cookiejar.Jar не позволяет получить все куки)
+	entries        map[string]storedCookie
+	persistSession bool
+}
+
+// NewJar Создает хранилище кук. publicSuffixList (например, publicsuffix.List из golang.org/x/net/publicsuffix)
+// не позволяет сайтам устанавливать куки на домены вроде co.uk. nil - используется только правило для доменов верхнего уровня
+func NewJar(publicSuffixList cookiejar.PublicSuffixList) *Jar {
+	j := &Jar{
+		options: cookiejar.Options{PublicSuffixList: publicSuffixList},
+		entries: make(map[string]storedCookie),
+	}
+	j.jar, _ = cookiejar.New(&j.options)
+
+	return j
+}
+
+// SetCookies Сохраняет куки, полученные с адреса u
+func (j *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.jar.SetCookies(u, cookies)
+
+	now := time.Now()
+	for _, cookie := range cookies {
+		j.record(u, cookie, now)
+	}
+}
+
+// Cookies Возвращает куки, которые нужно отправить на адрес u
+func (j *Jar) Cookies(u *url.URL) []*http.Cookie {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	return j.jar.Cookies(u)
+}
+
+// Clear Удаляет все куки
+func (j *Jar) Clear() {
+	jar, _ := cookiejar.New(&j.options)
+
+	j.mu.Lock()
+	j.jar = jar
+	j.entries = make(map[string]storedCookie)
+	j.mu.Unlock()
+}
+
+// Cookies Возвращает куки из хранилища клиента, которые будут отправлены на rawURL
+func (w *Webclient) Cookies(rawURL string) ([]*http.Cookie, error) {
+	if w.client.Jar == nil {
+		return nil, ErrNoCookieJar
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return w.client.Jar.Cookies(u), nil
+}
+
+// SetCookies Сохраняет куки в хранилище клиента так, как если бы их установил ответ с адреса rawURL
+func (w *Webclient) SetCookies(rawURL string, cookies ...*http.Cookie) error {
+	if w.client.Jar == nil {
+		return ErrNoCookieJar
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	w.client.Jar.SetCookies(u, cookies)
+
+	return nil
+}
+
+// CookieJar Возвращает хранилище кук клиента (по умолчанию *Jar) или nil, если оно отключено
+func (w *Webclient) CookieJar() http.CookieJar {
+	return w.client.Jar
+}
+
+// ClearCookies Удаляет все куки из хранилища клиента (хранилище должно поддерживать метод Clear, как Jar).
+// Хранилище общее для клиентов, созданных через With, Proxy и Dialer
+func (w *Webclient) ClearCookies() error {
+	if w.client.Jar == nil {
+		return ErrNoCookieJar
+	}
+
+	jar, ok := w.client.Jar.(interface{ Clear() })
+	if !ok {
+		return ErrJarNotClearable
+	}
+
+	jar.Clear()
+
+	return nil
+}
+
+// cookieMatches Проверяет атрибуты куки (срок действия, Secure, Domain, Path) для адреса запроса
+func cookieMatches(cookie *http.Cookie, u *url.URL) bool {
+	if cookie.MaxAge < 0 || (!cookie.Expires.IsZero() && cookie.Expires.Before(time.Now())) {
+		return false
+	}
+
+	if cookie.Secure && u.Scheme != "https" {
+		return false
+	}
+
+	if domain := strings.ToLower(strings.TrimPrefix(cookie.Domain, ".")); len(domain) > 0 {
+		host := strings.ToLower(u.Hostname())
+		if host != domain && !strings.HasSuffix(host, "."+domain) {
+			return false
+		}
+	}
+
+	if path := cookie.Path; len(path) > 0 {
+		requestPath := u.EscapedPath()
+		if len(requestPath) == 0 {
+			requestPath = "/"
+		}
+
+		if requestPath != path && !(strings.HasPrefix(requestPath, path) &&
+			(strings.HasSuffix(path, "/") || requestPath[len(path)] == '/')) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,343 @@
+package webclient
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrCookieFormat Неизвестный формат файла кук или ошибка в его содержимом
+var ErrCookieFormat = errors.New("webclient: invalid cookie file")
+
+// CookieFormat Формат файла кук
+type CookieFormat int
+
+const (
+	// CookieJSON JSON массив кук со всеми атрибутами
+	CookieJSON CookieFormat = iota
+	// CookieNetscape Формат cookies.txt (Netscape), который понимают curl, wget и расширения браузеров
+	CookieNetscape
+)
+
+// storedCookie Кука в том виде, в котором она сохраняется в файл
+type storedCookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	// Домен без точки в начале. Для host-only кук (без атрибута Domain) - имя хоста
+	Domain   string `json:"domain"`
+	HostOnly bool   `json:"host_only"`
+	Path     string `json:"path"`
+	Secure   bool   `json:"secure"`
+	HttpOnly bool   `json:"http_only"`
+	// Нулевое значение - сессионная кука
+	Expires time.Time `json:"expires"`
+}
+
+// session Является ли кука сессионной (действует до завершения сессии, а не до даты)
+func (c storedCookie) session() bool {
+	return c.Expires.IsZero()
+}
+
+// expired Истек ли срок действия куки
+func (c storedCookie) expired(now time.Time) bool {
+	return !c.session() && !c.Expires.After(now)
+}
+
+// PersistSessionCookies Сохранять ли в Save сессионные куки (без Expires и Max-Age). По умолчанию не сохраняются,
+// как это делает браузер при закрытии
+func (j *Jar) PersistSessionCookies(persist bool) *Jar {
+	j.mu.Lock()
+	j.persistSession = persist
+	j.mu.Unlock()
+
+	return j
+}
+
+// Save Записывает куки в w в формате format. Просроченные куки не сохраняются
+func (j *Jar) Save(w io.Writer, format CookieFormat) error {
+	now := time.Now()
+
+	j.mu.RLock()
+	cookies := make([]storedCookie, 0, len(j.entries))
+	for _, cookie := range j.entries {
+		if cookie.expired(now) || (cookie.session() && !j.persistSession) {
+			continue
+		}
+		cookies = append(cookies, cookie)
+	}
+	j.mu.RUnlock()
+
+	sort.Slice(cookies, func(a, b int) bool {
+		return cookieKey(cookies[a]) < cookieKey(cookies[b])
+	})
+
+	switch format {
+	case CookieJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(cookies)
+	case CookieNetscape:
+		return writeNetscapeCookies(w, cookies)
+	}
+
+	return fmt.Errorf("%w: unknown format %d", ErrCookieFormat, format)
+}
+
+// Load Загружает куки из r в формате format, добавляя их к уже имеющимся. Просроченные куки пропускаются
+func (j *Jar) Load(r io.Reader, format CookieFormat) error {
+	var (
+		cookies []storedCookie
+		err     error
+	)
+
+	switch format {
+	case CookieJSON:
+		if err = json.NewDecoder(r).Decode(&cookies); err != nil {
+			err = fmt.Errorf("%w: %v", ErrCookieFormat, err)
+		}
+	case CookieNetscape:
+		cookies, err = readNetscapeCookies(r)
+	default:
+		err = fmt.Errorf("%w: unknown format %d", ErrCookieFormat, format)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, cookie := range cookies {
+		if cookie.expired(now) || len(cookie.Name) == 0 || len(cookie.Domain) == 0 {
+			continue
+		}
+
+		// Кука восстанавливается так, как если бы ее установил ответ с ее домена
+		scheme := "http"
+		if cookie.Secure {
+			scheme = "https"
+		}
+
+		path := cookie.Path
+		if !strings.HasPrefix(path, "/") {
+			path = "/"
+		}
+
+		u := &url.URL{Scheme: scheme, Host: cookie.Domain, Path: path}
+		c := &http.Cookie{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Path:     path,
+			Secure:   cookie.Secure,
+			HttpOnly: cookie.HttpOnly,
+			Expires:  cookie.Expires,
+		}
+		if !cookie.HostOnly {
+			c.Domain = cookie.Domain
+		}
+
+		j.SetCookies(u, []*http.Cookie{c})
+	}
+
+	return nil
+}
+
+// SaveFile Атомарно записывает куки в файл path (права 0600, т.к. куки содержат данные авторизации)
+func (j *Jar) SaveFile(path string, format CookieFormat) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".cookies-")
+	if err != nil {
+		return err
+	}
+
+	err = j.Save(tmp, format)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0600)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+
+	return err
+}
+
+// LoadFile Загружает куки из файла path. Если файла нет, возвращается ошибка (os.IsNotExist)
+func (j *Jar) LoadFile(path string, format CookieFormat) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return j.Load(file, format)
+}
+
+// record Запоминает принятую куку (или удаляет, если ее срок истек) с теми же доменом и путем, что вычисляет cookiejar.Jar
+func (j *Jar) record(u *url.URL, c *http.Cookie, now time.Time) {
+	host := strings.ToLower(u.Hostname())
+	cookie := storedCookie{
+		Name:     c.Name,
+		Value:    c.Value,
+		Domain:   host,
+		HostOnly: true,
+		Path:     c.Path,
+		Secure:   c.Secure,
+		HttpOnly: c.HttpOnly,
+	}
+
+	if domain := strings.ToLower(strings.TrimPrefix(c.Domain, ".")); len(domain) > 0 {
+		if host != domain && !strings.HasSuffix(host, "."+domain) {
+			// Такую куку cookiejar.Jar не примет
+			return
+		}
+
+		if list := j.options.PublicSuffixList; list != nil && list.PublicSuffix(domain) == domain {
+			// Кука на публичный суффикс допустима только как host-only
+			if host != domain {
+				return
+			}
+		} else {
+			cookie.Domain = domain
+			cookie.HostOnly = false
+		}
+	}
+
+	if !strings.HasPrefix(cookie.Path, "/") {
+		cookie.Path = defaultCookiePath(u.Path)
+	}
+
+	key := cookieKey(cookie)
+
+	switch {
+	case c.MaxAge < 0:
+		delete(j.entries, key)
+		return
+	case c.MaxAge > 0:
+		cookie.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+	case !c.Expires.IsZero():
+		if !c.Expires.After(now) {
+			delete(j.entries, key)
+			return
+		}
+		cookie.Expires = c.Expires
+	}
+
+	j.entries[key] = cookie
+}
+
+// cookieKey Ключ куки: кука с тем же доменом, путем и именем заменяет предыдущую
+func cookieKey(c storedCookie) string {
+	return c.Domain + ";" + c.Path + ";" + c.Name
+}
+
+// defaultCookiePath Путь куки по умолчанию (RFC 6265, 5.1.4): каталог пути запроса
+func defaultCookiePath(path string) string {
+	i := strings.LastIndex(path, "/")
+	if len(path) == 0 || path[0] != '/' || i == 0 {
+		return "/"
+	}
+
+	return path[:i]
+}
+
+// writeNetscapeCookies Записывает куки в формате cookies.txt:
+// domain, include subdomains, path, secure, expires (unix, 0 - сессионная), name, value через табуляцию
+func writeNetscapeCookies(w io.Writer, cookies []storedCookie) error {
+	buf := bufio.NewWriter(w)
+	buf.WriteString("# Netscape HTTP Cookie File\n\n")
+
+	for _, c := range cookies {
+		domain := c.Domain
+		if !c.HostOnly {
+			domain = "." + domain
+		}
+		if c.HttpOnly {
+			domain = "#HttpOnly_" + domain
+		}
+
+		var expires int64
+		if !c.session() {
+			expires = c.Expires.Unix()
+		}
+
+		fmt.Fprintf(buf, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			domain, netscapeBool(!c.HostOnly), c.Path, netscapeBool(c.Secure), expires, c.Name, c.Value)
+	}
+
+	return buf.Flush()
+}
+
+// readNetscapeCookies Разбирает файл в формате cookies.txt
+func readNetscapeCookies(r io.Reader) ([]storedCookie, error) {
+	var cookies []storedCookie
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+
+		httpOnly := strings.HasPrefix(text, "#HttpOnly_")
+		if httpOnly {
+			text = strings.TrimPrefix(text, "#HttpOnly_")
+		}
+
+		if len(strings.TrimSpace(text)) == 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Split(text, "\t")
+		if len(fields) == 6 {
+			// Пустое значение куки
+			fields = append(fields, "")
+		}
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("%w: line %d: expected 7 fields, got %d", ErrCookieFormat, line, len(fields))
+		}
+
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: invalid expires: %v", ErrCookieFormat, line, err)
+		}
+
+		cookie := storedCookie{
+			Name:     fields[5],
+			Value:    fields[6],
+			Domain:   strings.ToLower(strings.TrimPrefix(fields[0], ".")),
+			HostOnly: !strings.EqualFold(fields[1], "TRUE"),
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			HttpOnly: httpOnly,
+		}
+		if expires > 0 {
+			cookie.Expires = time.Unix(expires, 0)
+		}
+
+		cookies = append(cookies, cookie)
+	}
+
+	return cookies, scanner.Err()
+}
+
+// netscapeBool Логическое значение в формате cookies.txt
+func netscapeBool(v bool) string {
+	if v {
+		return "TRUE"
+	}
+
+	return "FALSE"
+}
@@ -0,0 +1,240 @@
+package webclient
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSuffixList Публичные суффиксы для тестов: co.uk
+type testSuffixList struct{}
+
+func (testSuffixList) PublicSuffix(domain string) string {
+	if domain == "co.uk" || strings.HasSuffix(domain, ".co.uk") {
+		return "co.uk"
+	}
+
+	return domain[strings.LastIndex(domain, ".")+1:]
+}
+
+func (testSuffixList) String() string {
+	return "test"
+}
+
+func TestCookieJar(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "42"})
+			return
+		}
+
+		if cookie, err := r.Cookie("session"); err == nil {
+			w.Write([]byte(cookie.Value))
+		}
+	}))
+	defer ts.Close()
+
+	client := New()
+	client.Get(ts.URL + "/login").Do()
+
+	cookies, err := client.Cookies(ts.URL)
+	if err != nil || len(cookies) != 1 || cookies[0].Value != "42" {
+		t.Errorf("Expected cookie session=42, got: %v (%v)", cookies, err)
+	}
+
+	if _, body, _ := client.Get(ts.URL).Do(); body != "42" {
+		t.Errorf("Expected: %s, got: %s", "42", body)
+	}
+
+	// Запрос со своим хранилищем не использует куки клиента
+	if _, body, _ := client.Get(ts.URL).CookieJar(NewJar(nil)).Do(); body != "" {
+		t.Errorf("Expected empty body, got: %s", body)
+	}
+
+	if err := client.SetCookies(ts.URL, &http.Cookie{Name: "session", Value: "43"}); err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	if _, body, _ := client.Get(ts.URL).Do(); body != "43" {
+		t.Errorf("Expected: %s, got: %s", "43", body)
+	}
+
+	if err := client.ClearCookies(); err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	if _, body, _ := client.Get(ts.URL).Do(); body != "" {
+		t.Errorf("Cookies should be cleared, got: %s", body)
+	}
+
+	disabled := New(WithCookieJar(nil))
+	disabled.Get(ts.URL + "/login").Do()
+
+	if _, err := disabled.Cookies(ts.URL); !errors.Is(err, ErrNoCookieJar) {
+		t.Errorf("Expected error: %v, got: %v", ErrNoCookieJar, err)
+	}
+
+	disabled = Config{DisableCookieJar: true}.New()
+	if _, body, _ := disabled.Get(ts.URL).Do(); body != "" {
+		t.Errorf("Expected empty body, got: %s", body)
+	}
+}
+
+func TestJar_PublicSuffixList(t *testing.T) {
+	u, _ := url.Parse("http://shop.example.co.uk/")
+	cookies := []*http.Cookie{
+		{Name: "public", Value: "1", Domain: "co.uk"},
+		{Name: "site", Value: "2", Domain: "example.co.uk"},
+	}
+
+	jar := NewJar(testSuffixList{})
+	jar.SetCookies(u, cookies)
+
+	other, _ := url.Parse("http://other.co.uk/")
+	if got := jar.Cookies(other); len(got) != 0 {
+		t.Errorf("Cookie for public suffix should be rejected, got: %v", got)
+	}
+
+	if got := jar.Cookies(u); len(got) != 1 || got[0].Name != "site" {
+		t.Errorf("Expected cookie site=2, got: %v", got)
+	}
+}
+
+func TestRequest_AddCookie(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Cookie")))
+	}))
+	defer ts.Close()
+
+	client := New()
+
+	_, body, err := client.Get(ts.URL+"/api/items").
+		Cookie("a", "1").
+		AddCookie(&http.Cookie{Name: "b", Value: "2", Path: "/api"}).
+		AddCookie(&http.Cookie{Name: "c", Value: "3", Path: "/admin"}).
+		AddCookie(&http.Cookie{Name: "d", Value: "4", Secure: true}).
+		AddCookie(&http.Cookie{Name: "e", Value: "5", Expires: time.Now().Add(-time.Hour)}).
+		AddCookie(&http.Cookie{Name: "f", Value: "6", Domain: "example.com"}).
+		Cookie("a", "7").
+		Do()
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	if expected := "a=7; b=2"; body != expected {
+		t.Errorf("Expected: %s, got: %s", expected, body)
+	}
+}
+
+func TestJar_SaveLoad(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "token", Value: "abc", Path: "/", MaxAge: 3600, HttpOnly: true})
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "tmp", Path: "/"})
+			http.SetCookie(w, &http.Cookie{Name: "old", Value: "1", Path: "/", Expires: time.Now().Add(-time.Hour)})
+		case "/logout-old":
+			http.SetCookie(w, &http.Cookie{Name: "token", Value: "", Path: "/", MaxAge: -1})
+		default:
+			w.Write([]byte(r.Header.Get("Cookie")))
+		}
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "webclient-cookies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, format := range []CookieFormat{CookieJSON, CookieNetscape} {
+		jar := NewJar(nil)
+		client := Config{CookieJar: jar}.New()
+		client.Get(ts.URL + "/login").Do()
+
+		path := filepath.Join(dir, "cookies")
+		if err := jar.SaveFile(path, format); err != nil {
+			t.Fatalf("Format %d: got unexpected error: %v", format, err)
+		}
+
+		// Сессионные куки по умолчанию не сохраняются
+		loaded := NewJar(nil)
+		if err := loaded.LoadFile(path, format); err != nil {
+			t.Fatalf("Format %d: got unexpected error: %v", format, err)
+		}
+
+		restored := New(WithCookieJar(loaded))
+		if _, body, _ := restored.Get(ts.URL).Do(); body != "token=abc" {
+			t.Errorf("Format %d: expected: %s, got: %s", format, "token=abc", body)
+		}
+
+		jar.PersistSessionCookies(true).SaveFile(path, format)
+
+		loaded = NewJar(nil)
+		loaded.LoadFile(path, format)
+
+		restored = New(WithCookieJar(loaded))
+		if _, body, _ := restored.Get(ts.URL).Do(); body != "session=tmp; token=abc" && body != "token=abc; session=tmp" {
+			t.Errorf("Format %d: expected session and token cookies, got: %s", format, body)
+		}
+
+		// Удаленная сервером кука не сохраняется
+		client.Get(ts.URL + "/logout-old").Do()
+
+		var buf bytes.Buffer
+		jar.Save(&buf, format)
+		if strings.Contains(buf.String(), "token") {
+			t.Errorf("Format %d: deleted cookie should not be saved: %s", format, buf.String())
+		}
+	}
+}
+
+func TestJar_LoadNetscape(t *testing.T) {
+	data := "# Netscape HTTP Cookie File\n" +
+		"\n" +
+		".example.com\tTRUE\t/\tFALSE\t" + strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10) + "\tdomain\t1\n" +
+		"#HttpOnly_api.example.com\tFALSE\t/v1\tTRUE\t0\thost\t2\n" +
+		"example.com\tFALSE\t/\tFALSE\t1\texpired\t3\n" +
+		"example.com\tFALSE\t/\tFALSE\t0\tempty\t\n"
+
+	jar := NewJar(nil)
+	if err := jar.Load(strings.NewReader(data), CookieNetscape); err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	cases := []struct {
+		url      string
+		expected string
+	}{
+		{"http://www.example.com/", "domain=1"},
+		{"https://api.example.com/v1/items", "host=2; domain=1"},
+		{"http://api.example.com/v1/items", "domain=1"},
+		{"http://example.com/", "domain=1; empty="},
+	}
+
+	for _, c := range cases {
+		u, _ := url.Parse(c.url)
+
+		var parts []string
+		for _, cookie := range jar.Cookies(u) {
+			parts = append(parts, cookie.Name+"="+cookie.Value)
+		}
+
+		if got := strings.Join(parts, "; "); got != c.expected {
+			t.Errorf("%s: expected: %s, got: %s", c.url, c.expected, got)
+		}
+	}
+
+	if err := jar.Load(strings.NewReader("example.com\tFALSE\t/\n"), CookieNetscape); !errors.Is(err, ErrCookieFormat) {
+		t.Errorf("Expected error: %v, got: %v", ErrCookieFormat, err)
+	}
+}
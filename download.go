@@ -0,0 +1,444 @@
+package webclient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDownloadFailed Сервер вернул неуспешный статус при загрузке файла
+var ErrDownloadFailed = errors.New("webclient: download failed")
+
+// Download Загрузка файла с докачкой (Range запросы) после сбоев.
+// Данные пишутся во временный файл <path>.part, который переименовывается в path после успешной загрузки.
+// Если загрузка одним потоком не удалась, <path>.part и валидатор файла (<path>.part.validator) сохраняются,
+// и следующий Do продолжает загрузку с места обрыва
+type Download struct {
+	client  *Webclient
+	url     string
+	path    string
+	retries int
+	delay   time.Duration
+	chunks  int
+	headers map[string]string
+
+	progress ProgressFunc
+	mu       sync.Mutex
+	written  int64
+	total    int64
+}
+
+// Download Создает загрузку файла url в path. Запросы строятся через Get
+func (w *Webclient) Download(url string, path string) *Download {
+	return &Download{
+		client:  w,
+		url:     url,
+		path:    path,
+		retries: 3,
+		delay:   time.Second,
+		chunks:  1,
+		headers: make(map[string]string),
+		total:   -1,
+	}
+}
+
+// Retries Устанавливает количество попыток докачки после сбоя (по умолчанию 3)
+func (d *Download) Retries(retries int) *Download {
+	d.retries = retries
+	return d
+}
+
+// RetryDelay Устанавливает паузу между попытками (по умолчанию 1 секунда)
+func (d *Download) RetryDelay(delay time.Duration) *Download {
+	d.delay = delay
+	return d
+}
+
+// Chunks Загружает файл параллельно в n частей, если сервер поддерживает Range запросы.
+// Иначе файл загружается одним запросом
+func (d *Download) Chunks(n int) *Download {
+	if n < 1 {
+		n = 1
+	}
+
+	d.chunks = n
+	return d
+}
+
+// SetHeader Устанавливает заголовок для всех запросов загрузки
+func (d *Download) SetHeader(header string, data string) *Download {
+	d.headers[header] = data
+	return d
+}
+
+// OnProgress Устанавливает функцию, получающую прогресс загрузки (с учетом уже загруженной части)
+func (d *Download) OnProgress(fn func(received int64, total int64)) *Download {
+	d.progress = fn
+	return d
+}
+
+// Do Выполняет загрузку. При загрузке одним потоком продолжает ранее прерванную загрузку
+func (d *Download) Do() error {
+	tmpPath := d.path + ".part"
+
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+
+	if d.chunks > 1 {
+		// Параллельная загрузка не докачивается: части начинаются заново
+		if err = file.Truncate(0); err == nil {
+			err = d.parallel(file)
+		}
+	} else {
+		err = d.sequential(file)
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		// Без валидатора докачка небезопасна, поэтому временный файл оставляется только вместе с ним
+		if _, statErr := os.Stat(d.validatorPath()); d.chunks > 1 || statErr != nil {
+			os.Remove(tmpPath)
+			os.Remove(d.validatorPath())
+		}
+		return err
+	}
+
+	os.Remove(d.validatorPath())
+
+	return os.Rename(tmpPath, d.path)
+}
+
+// validatorPath Путь к файлу с валидатором (ETag или Last-Modified) частично загруженного файла
+func (d *Download) validatorPath() string {
+	return d.path + ".part.validator"
+}
+
+// saveValidator Сохраняет валидатор для докачки в следующих вызовах Do (пустой валидатор удаляет файл)
+func (d *Download) saveValidator(validator string) error {
+	if len(validator) == 0 {
+		if err := os.Remove(d.validatorPath()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	return ioutil.WriteFile(d.validatorPath(), []byte(validator), 0644)
+}
+
+// resumeState Возвращает размер частично загруженного файла и его валидатор.
+// Файл без валидатора докачивать нельзя, поэтому он очищается
+func (d *Download) resumeState(file *os.File) (int64, string, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return 0, "", err
+	}
+
+	data, err := ioutil.ReadFile(d.validatorPath())
+	if err != nil || len(data) == 0 || info.Size() == 0 {
+		if err := file.Truncate(0); err != nil {
+			return 0, "", err
+		}
+		return 0, "", d.saveValidator("")
+	}
+
+	return info.Size(), string(data), nil
+}
+
+// request Создает запрос на часть файла начиная с offset (end < 0 - до конца файла).
+// validator передается в If-Range, чтобы при изменении файла сервер вернул его целиком
+func (d *Download) request(offset int64, end int64, validator string) *Request {
+	// Файл сохраняется как есть, поэтому сжатие не запрашивается
+	req := d.client.Get(d.url).SetHeader("Accept-Encoding", "identity").SetHeaders(d.headers).RawEncoding(true)
+
+	if offset > 0 || end >= 0 {
+		rng := fmt.Sprintf("bytes=%d-", offset)
+		if end >= 0 {
+			rng += strconv.FormatInt(end, 10)
+		}
+
+		req.SetHeader("Range", rng)
+
+		if len(validator) > 0 {
+			req.SetHeader("If-Range", validator)
+		}
+	}
+
+	return req
+}
+
+// sequential Загружает файл одним потоком, докачивая его с места обрыва (в том числе после прошлого вызова Do)
+func (d *Download) sequential(file *os.File) error {
+	offset, validator, err := d.resumeState(file)
+	if err != nil {
+		return err
+	}
+	d.setWritten(offset)
+
+	var lastErr error
+
+	for attempt := 0; attempt <= d.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(d.delay)
+		}
+
+		resp, err := d.request(offset, -1, validator).Stream()
+		if err != nil {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			lastErr = err
+			continue
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusPartialContent && rangeStart(resp) == offset:
+			// Сервер продолжил с нужного места
+		case resp.StatusCode == http.StatusOK:
+			// Сервер проигнорировал Range (или файл изменился) -> загружаем заново с валидатором нового ответа
+			offset = 0
+			d.setWritten(0)
+			validator = rangeValidator(resp)
+			if err := file.Truncate(0); err != nil {
+				resp.Body.Close()
+				return err
+			}
+			if err := d.saveValidator(validator); err != nil {
+				resp.Body.Close()
+				return err
+			}
+		case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && rangeTotal(resp) == offset:
+			// Файл уже загружен полностью
+			resp.Body.Close()
+			return nil
+		default:
+			resp.Body.Close()
+			lastErr = fmt.Errorf("%w: %s", ErrDownloadFailed, resp.Status)
+
+			// Ошибки клиента повторять бессмысленно
+			if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+				return lastErr
+			}
+			continue
+		}
+
+		if total := rangeTotal(resp); total >= 0 {
+			d.total = total
+		}
+
+		n, err := io.Copy(&offsetWriter{file: file, offset: offset, download: d}, resp.Body)
+		resp.Body.Close()
+		offset += n
+
+		if err == nil && (d.total < 0 || offset >= d.total) {
+			return nil
+		}
+
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		lastErr = err
+
+		// Без валидатора докачка небезопасна: файл на сервере мог измениться
+		if len(validator) == 0 {
+			offset = 0
+			d.setWritten(0)
+			if err := file.Truncate(0); err != nil {
+				return err
+			}
+		}
+	}
+
+	return lastErr
+}
+
+// parallel Загружает файл параллельными частями. Если сервер не поддерживает Range -> загружает одним потоком
+func (d *Download) parallel(file *os.File) error {
+	resp, err := d.request(0, 0, "").Stream()
+	if err != nil {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	resp.Body.Close()
+
+	total := rangeTotal(resp)
+	validator := rangeValidator(resp)
+	if resp.StatusCode != http.StatusPartialContent || total <= 0 || len(validator) == 0 {
+		return d.sequential(file)
+	}
+
+	d.total = total
+	if err := file.Truncate(total); err != nil {
+		return err
+	}
+
+	chunkSize := (total + int64(d.chunks) - 1) / int64(d.chunks)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+
+	for start := int64(0); start < total; start += chunkSize {
+		end := start + chunkSize - 1
+		if end >= total {
+			end = total - 1
+		}
+
+		wg.Add(1)
+		go func(start int64, end int64) {
+			defer wg.Done()
+
+			if err := d.chunk(file, start, end, validator); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(start, end)
+	}
+
+	wg.Wait()
+
+	return firstErr
+}
+
+// chunk Загружает часть файла [start, end], докачивая ее после сбоев
+func (d *Download) chunk(file *os.File, start int64, end int64, validator string) error {
+	var lastErr error
+
+	offset := start
+	for attempt := 0; attempt <= d.retries && offset <= end; attempt++ {
+		if attempt > 0 {
+			time.Sleep(d.delay)
+		}
+
+		resp, err := d.request(offset, end, validator).Stream()
+		if err != nil {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			lastErr = err
+			continue
+		}
+
+		// Файл на сервере изменился или Range не поддерживается -> часть загрузить нельзя
+		if resp.StatusCode != http.StatusPartialContent || rangeStart(resp) != offset {
+			resp.Body.Close()
+			return fmt.Errorf("%w: unexpected response for range %d-%d: %s", ErrDownloadFailed, offset, end, resp.Status)
+		}
+
+		n, err := io.Copy(&offsetWriter{file: file, offset: offset, download: d}, io.LimitReader(resp.Body, end-offset+1))
+		resp.Body.Close()
+		offset += n
+
+		if err != nil {
+			lastErr = err
+		} else if offset <= end {
+			lastErr = io.ErrUnexpectedEOF
+		}
+	}
+
+	if offset <= end {
+		return lastErr
+	}
+
+	return nil
+}
+
+// setWritten Сбрасывает счетчик загруженных данных
+func (d *Download) setWritten(n int64) {
+	d.mu.Lock()
+	d.written = n
+	d.mu.Unlock()
+}
+
+// addWritten Учитывает загруженные данные и сообщает прогресс.
+// Вызовы OnProgress сериализуются, поэтому значения передаются по возрастанию даже при параллельной загрузке
+func (d *Download) addWritten(n int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.written += n
+	if d.progress != nil {
+		d.progress(d.written, d.total)
+	}
+}
+
+// offsetWriter Пишет данные в файл начиная с offset
+type offsetWriter struct {
+	file     *os.File
+	offset   int64
+	download *Download
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.file.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	w.download.addWritten(int64(n))
+
+	return n, err
+}
+
+// rangeValidator Возвращает значение для If-Range: сильный ETag или Last-Modified
+func rangeValidator(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); len(etag) > 0 && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+
+	return resp.Header.Get("Last-Modified")
+}
+
+// parseContentRange Разбирает Content-Range: bytes start-end/total (или bytes */total)
+func parseContentRange(resp *http.Response) (start int64, total int64) {
+	start, total = -1, -1
+
+	value := strings.TrimPrefix(resp.Header.Get("Content-Range"), "bytes ")
+	slash := strings.Index(value, "/")
+	if slash < 0 {
+		return
+	}
+
+	if t, err := strconv.ParseInt(value[slash+1:], 10, 64); err == nil {
+		total = t
+	}
+
+	if dash := strings.Index(value[:slash], "-"); dash >= 0 {
+		if s, err := strconv.ParseInt(value[:dash], 10, 64); err == nil {
+			start = s
+		}
+	}
+
+	return
+}
+
+// rangeStart Начало диапазона из Content-Range или -1
+func rangeStart(resp *http.Response) int64 {
+	start, _ := parseContentRange(resp)
+	return start
+}
+
+// rangeTotal Полный размер файла из Content-Range (или Content-Length для 200 ответа), -1 если он неизвестен
+func rangeTotal(resp *http.Response) int64 {
+	if resp.StatusCode == http.StatusOK {
+		return resp.ContentLength
+	}
+
+	_, total := parseContentRange(resp)
+	return total
+}
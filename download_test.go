@@ -0,0 +1,219 @@
+package webclient
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// cutWriter Обрывает ответ после limit байт тела
+type cutWriter struct {
+	http.ResponseWriter
+	limit int
+}
+
+func (w *cutWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		w.ResponseWriter.Write(p[:w.limit])
+		w.ResponseWriter.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+
+	w.limit -= len(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func TestDownload(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789abcdef", 10000))
+	modified := time.Date(2020, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	var calls int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+
+		switch r.URL.Path {
+		case "/resume":
+			// Первый запрос обрывается на середине
+			w.Header().Set("ETag", `"v1"`)
+			if n == 1 {
+				w = &cutWriter{ResponseWriter: w, limit: len(content) / 2}
+			}
+			http.ServeContent(w, r, "file.bin", modified, bytes.NewReader(content))
+		case "/parallel":
+			w.Header().Set("ETag", `"v1"`)
+			http.ServeContent(w, r, "file.bin", modified, bytes.NewReader(content))
+		case "/no-range":
+			// Range игнорируется
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write(content)
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	}))
+
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "webclient")
+	if err != nil {
+		t.Fatalf("Cant create temp dir: %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	client := Config{}.New()
+
+	cases := []struct {
+		path   string
+		chunks int
+		calls  int32
+	}{
+		{"/resume", 1, 2},
+		{"/parallel", 4, 5},
+		{"/no-range", 4, 2},
+	}
+
+	for _, c := range cases {
+		atomic.StoreInt32(&calls, 0)
+		target := filepath.Join(dir, strings.TrimPrefix(c.path, "/"))
+
+		var received, total int64
+		err := client.Download(ts.URL+c.path, target).
+			Chunks(c.chunks).
+			RetryDelay(time.Millisecond).
+			OnProgress(func(current int64, all int64) {
+				atomic.StoreInt64(&received, current)
+				atomic.StoreInt64(&total, all)
+			}).
+			Do()
+		if err != nil {
+			t.Errorf("%s: got unexpected error: %v", c.path, err)
+			continue
+		}
+
+		d, _ := ioutil.ReadFile(target)
+		if !bytes.Equal(d, content) {
+			t.Errorf("%s: downloaded file differs, length: %d", c.path, len(d))
+		}
+
+		if atomic.LoadInt64(&received) != int64(len(content)) || atomic.LoadInt64(&total) != int64(len(content)) {
+			t.Errorf("%s: unexpected progress: %d/%d", c.path, received, total)
+		}
+
+		if atomic.LoadInt32(&calls) != c.calls {
+			t.Errorf("%s: expected requests: %d, got: %d", c.path, c.calls, atomic.LoadInt32(&calls))
+		}
+
+		if _, err := os.Stat(target + ".part"); !os.IsNotExist(err) {
+			t.Errorf("%s: temporary file should be removed", c.path)
+		}
+	}
+}
+
+func TestDownload_ResumeAcrossCalls(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789abcdef", 10000))
+	modified := time.Date(2020, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	var (
+		calls   int32
+		etag    atomic.Value
+		ranges        = make(chan string, 10)
+		cutNext int32 = 1
+	)
+	etag.Store(`"v1"`)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		ranges <- r.Header.Get("Range") + ";" + r.Header.Get("If-Range")
+
+		w.Header().Set("ETag", etag.Load().(string))
+		if atomic.CompareAndSwapInt32(&cutNext, 1, 0) {
+			w = &cutWriter{ResponseWriter: w, limit: len(content) / 2}
+		}
+		http.ServeContent(w, r, "file.bin", modified, bytes.NewReader(content))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "webclient")
+	if err != nil {
+		t.Fatalf("Cant create temp dir: %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	client := Config{}.New()
+	target := filepath.Join(dir, "file.bin")
+
+	// Первый вызов обрывается: временный файл и валидатор остаются для докачки
+	if err := client.Download(ts.URL, target).Retries(0).Do(); err == nil {
+		t.Fatalf("Expected error for interrupted download")
+	}
+
+	info, err := os.Stat(target + ".part")
+	if err != nil || info.Size() != int64(len(content)/2) {
+		t.Fatalf("Partial file should be kept, got: %v", err)
+	}
+
+	if v, _ := ioutil.ReadFile(target + ".part.validator"); string(v) != `"v1"` {
+		t.Errorf("Expected validator: %s, got: %s", `"v1"`, v)
+	}
+
+	// Второй вызов продолжает с места обрыва
+	if err := client.Download(ts.URL, target).Retries(0).Do(); err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	<-ranges
+	expected := "bytes=" + strconv.Itoa(len(content)/2) + `-;"v1"`
+	if got := <-ranges; got != expected {
+		t.Errorf("Expected: %s, got: %s", expected, got)
+	}
+
+	d, _ := ioutil.ReadFile(target)
+	if !bytes.Equal(d, content) {
+		t.Errorf("Downloaded file differs, length: %d", len(d))
+	}
+
+	for _, name := range []string{target + ".part", target + ".part.validator"} {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s should be removed", name)
+		}
+	}
+
+	// Файл изменился: сервер отвечает 200, и сохраняется валидатор нового ответа
+	atomic.StoreInt32(&cutNext, 1)
+	if err := client.Download(ts.URL, target).Retries(0).Do(); err == nil {
+		t.Fatalf("Expected error for interrupted download")
+	}
+
+	etag.Store(`"v2"`)
+	atomic.StoreInt32(&cutNext, 1)
+	if err := client.Download(ts.URL, target).Retries(0).Do(); err == nil {
+		t.Fatalf("Expected error for interrupted download")
+	}
+
+	if v, _ := ioutil.ReadFile(target + ".part.validator"); string(v) != `"v2"` {
+		t.Errorf("Expected validator: %s, got: %s", `"v2"`, v)
+	}
+
+	if err := client.Download(ts.URL, target).Retries(0).Do(); err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	d, _ = ioutil.ReadFile(target)
+	if !bytes.Equal(d, content) {
+		t.Errorf("Downloaded file differs, length: %d", len(d))
+	}
+
+	if n := atomic.LoadInt32(&calls); n != 5 {
+		t.Errorf("Expected requests: %d, got: %d", 5, n)
+	}
+}
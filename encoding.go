@@ -0,0 +1,278 @@
+package webclient
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrUnsupportedEncoding Для Content-Encoding не зарегистрирован кодировщик
+var ErrUnsupportedEncoding = errors.New("webclient: unsupported content encoding")
+
+// EncoderFunc Создает writer, который сжимает записанные в него данные и пишет результат в w
+type EncoderFunc func(w io.Writer) (io.WriteCloser, error)
+
+var encoders = struct {
+	sync.RWMutex
+	m map[string]EncoderFunc
+}{
+	m: map[string]EncoderFunc{
+		"gzip": func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		},
+		// В HTTP deflate означает zlib-формат (RFC 9110)
+		"deflate": func(w io.Writer) (io.WriteCloser, error) {
+			return zlib.NewWriter(w), nil
+		},
+	},
+}
+
+// RegisterEncoder Регистрирует кодировщик для Content-Encoding запросов (Request.Compress).
+// Встроены только gzip и deflate: библиотека не имеет внешних зависимостей, поэтому zstd и br
+// подключаются регистрацией, например с github.com/klauspost/compress/zstd и github.com/andybalholm/brotli:
+//
+//	webclient.RegisterEncoder("zstd", func(w io.Writer) (io.WriteCloser, error) {
+//		return zstd.NewWriter(w)
+//	})
+//	webclient.RegisterEncoder("br", func(w io.Writer) (io.WriteCloser, error) {
+//		return brotli.NewWriter(w), nil
+//	})
+func RegisterEncoder(encoding string, fn EncoderFunc) {
+	encoders.Lock()
+	defer encoders.Unlock()
+
+	encoders.m[strings.ToLower(encoding)] = fn
+}
+
+// lookupEncoder Ищет кодировщик для Content-Encoding
+func lookupEncoder(encoding string) (EncoderFunc, error) {
+	encoders.RLock()
+	defer encoders.RUnlock()
+
+	if fn, ok := encoders.m[strings.ToLower(encoding)]; ok {
+		return fn, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncoding, encoding)
+}
+
+// DecoderFunc Создает reader, распаковывающий данные из r
+type DecoderFunc func(r io.Reader) (io.ReadCloser, error)
+
+var decoders = struct {
+	sync.RWMutex
+	m map[string]DecoderFunc
+}{
+	m: map[string]DecoderFunc{
+		"gzip": func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+		"x-gzip": func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+		"deflate": newDeflateReader,
+	},
+}
+
+// RegisterDecoder Регистрирует распаковщик ответов для Content-Encoding.
+// Зарегистрированные кодировки автоматически добавляются в Accept-Encoding.
+// Встроены только gzip и deflate: br и zstd не поддерживаются, пока не зарегистрированы, например:
+//
+//	webclient.RegisterDecoder("br", func(r io.Reader) (io.ReadCloser, error) {
+//		return ioutil.NopCloser(brotli.NewReader(r)), nil
+//	})
+//	webclient.RegisterDecoder("zstd", func(r io.Reader) (io.ReadCloser, error) {
+//		d, err := zstd.NewReader(r)
+//		if err != nil {
+//			return nil, err
+//		}
+//		return d.IOReadCloser(), nil
+//	})
+func RegisterDecoder(encoding string, fn DecoderFunc) {
+	decoders.Lock()
+	defer decoders.Unlock()
+
+	decoders.m[strings.ToLower(encoding)] = fn
+}
+
+// acceptEncoding Значение Accept-Encoding со всеми зарегистрированными кодировками
+func acceptEncoding() string {
+	decoders.RLock()
+	defer decoders.RUnlock()
+
+	names := make([]string, 0, len(decoders.m))
+	for name := range decoders.m {
+		if !strings.HasPrefix(name, "x-") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
+
+// newDeflateReader Распаковывает deflate. Согласно RFC 9110 это zlib-формат,
+// но некоторые серверы отдают "сырой" deflate без zlib-заголовка
+func newDeflateReader(r io.Reader) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(r)
+
+	header, err := buffered.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+
+	// Проверка zlib-заголовка: CM = 8 и (CMF*256 + FLG) кратно 31
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(buffered)
+	}
+
+	return flate.NewReader(buffered), nil
+}
+
+// decompressResponse Распаковывает тело ответа согласно Content-Encoding.
+// При нескольких кодировках (gzip, br) они снимаются в обратном порядке
+func decompressResponse(resp *http.Response) error {
+	header := resp.Header.Get("Content-Encoding")
+	if len(header) == 0 || resp.Body == nil || resp.Body == http.NoBody {
+		return nil
+	}
+
+	encodings := strings.Split(header, ",")
+	body := resp.Body
+
+	for i := len(encodings) - 1; i >= 0; i-- {
+		encoding := strings.ToLower(strings.TrimSpace(encodings[i]))
+		if len(encoding) == 0 || encoding == "identity" {
+			continue
+		}
+
+		decoders.RLock()
+		fn, ok := decoders.m[encoding]
+		decoders.RUnlock()
+
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrUnsupportedEncoding, encoding)
+		}
+
+		decoded, err := fn(body)
+		if err != nil {
+			// Пустое тело (например, у 204/304) распаковывать нечего
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+
+		body = &decodedBody{ReadCloser: decoded, src: resp.Body}
+	}
+
+	resp.Body = body
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+
+	return nil
+}
+
+// decodedBody Распакованное тело ответа, при закрытии закрывает и исходное тело
+type decodedBody struct {
+	io.ReadCloser
+	src io.Closer
+}
+
+func (b *decodedBody) Close() error {
+	b.ReadCloser.Close()
+	return b.src.Close()
+}
+
+// compressedBody Тело запроса, которое сжимается по мере чтения.
+// Горутина сжатия запускается только при первом чтении
+type compressedBody struct {
+	src     io.ReadCloser
+	encoder EncoderFunc
+
+	once sync.Once
+	pr   *io.PipeReader
+	pw   *io.PipeWriter
+}
+
+// newCompressedBody Оборачивает src в сжимающий reader
+func newCompressedBody(src io.ReadCloser, encoder EncoderFunc) *compressedBody {
+	pr, pw := io.Pipe()
+
+	return &compressedBody{src: src, encoder: encoder, pr: pr, pw: pw}
+}
+
+func (b *compressedBody) Read(p []byte) (int, error) {
+	b.once.Do(func() {
+		go func() {
+			b.pw.CloseWithError(b.compress())
+		}()
+	})
+
+	return b.pr.Read(p)
+}
+
+func (b *compressedBody) Close() error {
+	b.pr.Close()
+	return b.src.Close()
+}
+
+// compress Копирует исходное тело через кодировщик в pipe
+func (b *compressedBody) compress() error {
+	w, err := b.encoder(b.pw)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, b.src); err != nil {
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}
+
+// compressRequest Сжимает тело req и устанавливает Content-Encoding.
+// Тела, размер которых известен и меньше threshold, а также уже сжатые тела остаются без изменений
+func compressRequest(req *http.Request, encoding string, threshold int64) error {
+	if req.Body == nil || req.Body == http.NoBody || len(req.Header.Get("Content-Encoding")) > 0 {
+		return nil
+	}
+
+	if req.ContentLength > 0 && req.ContentLength < threshold {
+		return nil
+	}
+
+	encoder, err := lookupEncoder(encoding)
+	if err != nil {
+		return err
+	}
+
+	req.Body = newCompressedBody(req.Body, encoder)
+	// Размер сжатого тела заранее неизвестен -> тело уйдет chunked
+	req.ContentLength = -1
+	req.Header.Set("Content-Encoding", strings.ToLower(encoding))
+
+	if getBody := req.GetBody; getBody != nil {
+		req.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+
+			return newCompressedBody(body, encoder), nil
+		}
+	}
+
+	return nil
+}
@@ -141,3 +141,59 @@ func ExampleRequest_SendPlain() {
 		SendPlain(rawJSON).
 		Do()
 }
+
+func ExampleRegisterCodec() {
+	// Для YAML, MessagePack, CBOR и т.п. достаточно один раз зарегистрировать кодек:
+	// RegisterCodec(TypeYAML, NewCodec(yaml.Marshal, yaml.Unmarshal))
+
+	client := Config{}.New()
+
+	var result struct {
+		ID string `json:"id"`
+	}
+
+	client.Post("http://example.com/track").
+		ContentType(TypeJSON).
+		SendStruct(map[string]string{"browser": "Opera"}).
+		Result(&result).
+		Do()
+}
+
+func ExampleRequest_SendProto() {
+	// Библиотека не зависит от google.golang.org/protobuf, поэтому для его сообщений
+	// кодеки регистрируются один раз при старте приложения:
+	// RegisterProtoCodec(TypeProtobuf, NewCodec(
+	// 	func(v interface{}) ([]byte, error) { return proto.Marshal(v.(proto.Message)) },
+	// 	func(data []byte, v interface{}) error { return proto.Unmarshal(data, v.(proto.Message)) },
+	// ))
+	// RegisterProtoCodec(TypeJSON, NewCodec(
+	// 	func(v interface{}) ([]byte, error) { return protojson.Marshal(v.(proto.Message)) },
+	// 	func(data []byte, v interface{}) error { return protojson.Unmarshal(data, v.(proto.Message)) },
+	// ))
+
+	var req, resp ProtoMessage // *pb.GetUserRequest, *pb.User
+
+	client := Config{}.New()
+	client.Post("http://example.com/v1/users").SendProto(req).Result(resp).Do()
+
+	// JSON-маппинг (grpc-gateway) - только после RegisterProtoCodec(TypeJSON, ...) с protojson,
+	// иначе Do вернет ErrCodecNotFound
+	client.Post("http://example.com/v1/users").ContentType(TypeJSON).SendProto(req).Result(resp).Do()
+}
+
+func ExampleWebclient_NewSession() {
+	client := New()
+	session := client.NewSession().
+		SetHeader("User-Agent", "Mozilla/5.0").
+		CSRF(CSRFFromHTML("csrf_token"), "", "csrf_token")
+
+	// Страница логина выдает куки и CSRF токен, который будет добавлен в форму
+	session.Get("https://example.com/login").Do()
+	session.Post("https://example.com/login").SendParam("user", "admin").SendParam("password", "secret").Do()
+
+	// Куки и Referer передаются автоматически
+	_, body, _ := session.Get("https://example.com/profile").Do()
+	fmt.Println(body)
+
+	session.Jar().SaveFile("/tmp/cookies.txt", CookieNetscape)
+}
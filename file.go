@@ -1,33 +1,182 @@
 package webclient
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
 	"path/filepath"
 )
 
+// sniffLen Количество байт, по которым http.DetectContentType определяет тип содержимого
+const sniffLen = 512
+
 // File Структура описывающая файл для отправки через client.SendFile
 type File struct {
 	// Название файла. По умолчанию используется имя переданного файла
 	Name string
-	// Тело файла
+	// Тело файла. Используется, если не указаны Reader и Path. NewFile его не заполняет
 	Data []byte
+	// Источник данных файла. Читается потоково в момент отправки запроса, поэтому такой File можно отправить только один раз.
+	// Если Reader реализует io.Closer, он будет закрыт после отправки
+	Reader io.Reader
+	// Путь до файла на диске. Файл открывается и читается потоково в момент отправки запроса
+	Path string
+	// Размер данных из Reader. Если не указан (<= 0), Content-Length запроса будет неизвестен и тело уйдет chunked
+	Size int64
 	// Параметр запроса, который отвечает за принятие файла
 	Param string
-	// ContentType переданного файла. Можно указать свой, иначе будет установлен соответсвующий разрешению файла
+	// ContentType переданного файла. Можно указать свой, иначе будет установлен соответсвующий разрешению файла,
+	// а если его определить не удалось - по первым 512 байтам содержимого
 	ContentType string
 }
 
+// ErrNotRegularFile Путь, переданный в NewFile, указывает не на обычный файл (например, на каталог)
+var ErrNotRegularFile = errors.New("webclient: not a regular file")
+
 // NewFile Создает новую структуру File.
-// error возможен только если переданный файл не удалось прочитать
+// Содержимое файла не загружается в память, а читается с диска в момент отправки запроса,
+// поэтому поле Data у возвращаемого File пустое (данные можно прочитать по Path).
+// error возможен, если файл не существует, не может быть открыт на чтение или не является обычным файлом
 func NewFile(path string, param string) (File, error) {
-	data, err := ioutil.ReadFile(path)
+	f, err := os.Open(path)
 	if err != nil {
 		return File{}, err
 	}
+	defer f.Close()
 
-	file := File{Data: data, Param: param}
+	info, err := f.Stat()
+	if err != nil {
+		return File{}, err
+	}
+
+	if !info.Mode().IsRegular() {
+		return File{}, fmt.Errorf("%w: %s", ErrNotRegularFile, path)
+	}
+
+	file := File{Path: path, Size: info.Size(), Param: param}
 	filename := filepath.Base(path)
 	file.Name = filename
 
 	return file, nil
-}
\ No newline at end of file
+}
+
+// NewFileReader Создает новую структуру File, данные которой будут прочитаны из reader.
+// size - размер данных, если он неизвестен необходимо передать 0
+func NewFileReader(reader io.Reader, name string, param string, size int64) File {
+	return File{Reader: reader, Name: name, Param: param, Size: size}
+}
+
+// length Возвращает размер файла или -1, если размер заранее неизвестен
+func (f File) length() int64 {
+	switch {
+	case f.Reader != nil:
+		if f.Size > 0 {
+			return f.Size
+		}
+
+		// Для открытых файлов размер можно узнать самостоятельно
+		if st, ok := f.Reader.(interface{ Stat() (os.FileInfo, error) }); ok {
+			if info, err := st.Stat(); err == nil && info.Mode().IsRegular() {
+				return info.Size()
+			}
+		}
+
+		return -1
+	case len(f.Path) > 0:
+		info, err := os.Stat(f.Path)
+		if err != nil {
+			return -1
+		}
+
+		return info.Size()
+	default:
+		return int64(len(f.Data))
+	}
+}
+
+// reusable Можно ли прочитать содержимое файла повторно (например, при редиректе)
+func (f File) reusable() bool {
+	return f.Reader == nil
+}
+
+// open Открывает источник данных файла для чтения
+func (f File) open() (io.ReadCloser, error) {
+	switch {
+	case f.Reader != nil:
+		if rc, ok := f.Reader.(io.ReadCloser); ok {
+			return rc, nil
+		}
+
+		return ioutil.NopCloser(f.Reader), nil
+	case len(f.Path) > 0:
+		return os.Open(f.Path)
+	default:
+		return ioutil.NopCloser(bytes.NewReader(f.Data)), nil
+	}
+}
+
+// withContentType Возвращает копию File с определенным ContentType.
+// Явно указанный ContentType не меняется. Иначе тип определяется по расширению имени файла,
+// а затем по первым 512 байтам содержимого (http.DetectContentType)
+func (f File) withContentType() (File, error) {
+	if len(f.ContentType) > 0 {
+		return f, nil
+	}
+
+	for _, name := range []string{f.Name, f.Path} {
+		if ctype := mime.TypeByExtension(filepath.Ext(name)); len(ctype) > 0 {
+			f.ContentType = ctype
+			return f, nil
+		}
+	}
+
+	switch {
+	case f.Reader != nil:
+		// После оборачивания Reader размер открытого файла уже не определить -> запоминаем его заранее
+		if f.Size <= 0 {
+			f.Size = f.length()
+		}
+
+		// Заглядываем в начало потока, не теряя прочитанные данные
+		buffered := bufio.NewReaderSize(f.Reader, sniffLen)
+		head, err := buffered.Peek(sniffLen)
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			return f, err
+		}
+
+		f.ContentType = http.DetectContentType(head)
+
+		if closer, ok := f.Reader.(io.Closer); ok {
+			f.Reader = struct {
+				io.Reader
+				io.Closer
+			}{buffered, closer}
+		} else {
+			f.Reader = buffered
+		}
+	case len(f.Path) > 0:
+		fd, err := os.Open(f.Path)
+		if err != nil {
+			return f, err
+		}
+		defer fd.Close()
+
+		head := make([]byte, sniffLen)
+		n, err := io.ReadFull(fd, head)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return f, err
+		}
+
+		f.ContentType = http.DetectContentType(head[:n])
+	default:
+		f.ContentType = http.DetectContentType(f.Data)
+	}
+
+	return f, nil
+}
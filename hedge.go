@@ -0,0 +1,163 @@
+package webclient
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Hedge Включает hedging для идемпотентных запросов (GET, HEAD, OPTIONS): если ответ не получен за after,
+// отправляется дубликат запроса, и так до max запросов (включая первый). Возвращается первый успешный ответ,
+// остальные запросы отменяются. Неудачный ответ (ошибка или статус 5xx) сразу запускает следующий запрос.
+// Запросы с телом из io.Reader (SendReader, NewFileReader) не дублируются
+func (r *Request) Hedge(after time.Duration, max int) *Request {
+	r.hedgeAfter = after
+	r.hedgeMax = max
+	return r
+}
+
+// hedgeable Можно ли безопасно отправить запрос несколько раз
+func (r *Request) hedgeable() bool {
+	if r.hedgeMax < 2 || r.bodyReader != nil {
+		return false
+	}
+
+	for _, file := range r.files {
+		if !file.reusable() {
+			return false
+		}
+	}
+
+	switch r.method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	return false
+}
+
+// hedgeAttempt Результат одного из дублирующих запросов
+type hedgeAttempt struct {
+	index  int
+	req    *http.Request
+	resp   *http.Response
+	err    error
+	cancel context.CancelFunc
+}
+
+// ok Является ли результат окончательным ответом сервера
+func (a hedgeAttempt) ok() bool {
+	return a.err == nil && a.resp.StatusCode < 500
+}
+
+// discard Освобождает ресурсы запроса, ответ которого не будет использован
+func (a hedgeAttempt) discard() {
+	if a.resp != nil {
+		a.resp.Body.Close()
+	}
+	a.cancel()
+}
+
+// hedge Выполняет запрос с дублированием. Каждый запрос строится заново через newRequest
+// и выполняется со своим контекстом, который отменяется для проигравших запросов
+func (r *Request) hedge() (*http.Request, *http.Response, error) {
+	results := make(chan hedgeAttempt, r.hedgeMax)
+	cancels := make([]context.CancelFunc, 0, r.hedgeMax)
+
+	launch := func() error {
+		req, err := r.newRequest()
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithCancel(r.ctx)
+		req = req.WithContext(ctx)
+		index := len(cancels)
+		cancels = append(cancels, cancel)
+
+		go func() {
+			resp, err := r.client.Do(req)
+			results <- hedgeAttempt{index: index, req: req, resp: resp, err: err, cancel: cancel}
+		}()
+
+		return nil
+	}
+
+	if err := launch(); err != nil {
+		return nil, nil, err
+	}
+
+	timer := time.NewTimer(r.hedgeAfter)
+	defer timer.Stop()
+
+	var last *hedgeAttempt
+	for pending := 1; pending > 0; {
+		select {
+		case <-timer.C:
+			if len(cancels) < r.hedgeMax {
+				if err := launch(); err == nil {
+					pending++
+				}
+				timer.Reset(r.hedgeAfter)
+			}
+
+		case attempt := <-results:
+			pending--
+
+			if attempt.ok() {
+				// Отменяем остальные запросы и закрываем их ответы, если они все же придут
+				for i, cancel := range cancels {
+					if i != attempt.index {
+						cancel()
+					}
+				}
+
+				go func(pending int) {
+					for i := 0; i < pending; i++ {
+						(<-results).discard()
+					}
+				}(pending)
+
+				// Тело неудачного ответа больше не нужно: закрытие освобождает соединение и слот bulkhead
+				if last != nil {
+					last.discard()
+				}
+
+				return attempt.req, withCancelOnClose(attempt.resp, attempt.cancel), nil
+			}
+
+			if last != nil {
+				last.discard()
+			}
+			last = &attempt
+
+			// Неудачный ответ -> не ждем таймера и сразу отправляем следующий запрос
+			if len(cancels) < r.hedgeMax && r.ctx.Err() == nil {
+				if err := launch(); err == nil {
+					pending++
+				}
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(r.hedgeAfter)
+			}
+		}
+	}
+
+	// Все запросы неудачны -> возвращаем результат последнего
+	if last.err != nil {
+		last.cancel()
+		return last.req, nil, last.err
+	}
+
+	return last.req, withCancelOnClose(last.resp, last.cancel), nil
+}
+
+// withCancelOnClose Отменяет контекст запроса при закрытии тела ответа (тело читается в контексте запроса)
+func withCancelOnClose(resp *http.Response, cancel context.CancelFunc) *http.Response {
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: cancel}
+	return resp
+}
@@ -0,0 +1,128 @@
+package webclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRequest_Hedge(t *testing.T) {
+	var calls, canceled int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			select {
+			case <-time.After(2 * time.Second):
+				w.Write([]byte("slow"))
+			case <-r.Context().Done():
+				atomic.StoreInt32(&canceled, 1)
+			}
+			return
+		}
+
+		w.Write([]byte("fast"))
+	}))
+	defer ts.Close()
+
+	client := Config{}.New()
+
+	start := time.Now()
+	_, body, err := client.Get(ts.URL).Hedge(50*time.Millisecond, 3).Do()
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	if body != "fast" {
+		t.Errorf("Expected: %s, got: %s", "fast", body)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Hedged request should not wait for the slow one, elapsed: %v", elapsed)
+	}
+
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("Expected 2 requests, got: %d", n)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&canceled) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if atomic.LoadInt32(&canceled) == 0 {
+		t.Errorf("Slow request should be canceled")
+	}
+}
+
+func TestRequest_HedgeFailure(t *testing.T) {
+	var calls int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	client := Config{}.New()
+
+	// Неудачные ответы сразу запускают следующий запрос, не дожидаясь after
+	resp, body, err := client.Get(ts.URL).Hedge(time.Minute, 3).Do()
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK || body != "ok" {
+		t.Errorf("Expected: %d %s, got: %d %s", http.StatusOK, "ok", resp.StatusCode, body)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+
+	// POST не дублируется
+	resp, _, err = client.Post(ts.URL).Hedge(time.Millisecond, 3).Do()
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusServiceUnavailable || atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("Non-idempotent request should be sent once, got %d requests", atomic.LoadInt32(&calls))
+	}
+}
+
+func TestRequest_HedgeBulkhead(t *testing.T) {
+	var calls int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Каждый первый запрос неудачен, дубликат успешен
+		if atomic.AddInt32(&calls, 1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	client := Config{MaxConcurrent: 2}.New()
+
+	// Неудачные ответы должны освобождать слоты, иначе после нескольких запросов bulkhead заполнится
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		_, body, err := client.Get(ts.URL).WithContext(ctx).Hedge(time.Minute, 2).Do()
+		cancel()
+
+		if err != nil {
+			t.Fatalf("Request %d: got unexpected error: %v", i, err)
+		}
+
+		if body != "ok" {
+			t.Errorf("Expected: %s, got: %s", "ok", body)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package webclient
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// multipartBody Тело multipart запроса, которое формируется по мере чтения.
+// Файлы не загружаются в память целиком, а копируются в io.Pipe фоновой горутиной
+type multipartBody struct {
+	boundary string
+	fields   map[string][]string
+	files    []File
+
+	once sync.Once
+	pr   *io.PipeReader
+	pw   *io.PipeWriter
+}
+
+// newMultipartBody Создает multipartBody. Горутина записи запускается только при первом чтении
+func newMultipartBody(boundary string, fields map[string][]string, files []File) *multipartBody {
+	pr, pw := io.Pipe()
+
+	return &multipartBody{
+		boundary: boundary,
+		fields:   fields,
+		files:    files,
+		pr:       pr,
+		pw:       pw,
+	}
+}
+
+// Read Читает очередную порцию тела запроса
+func (b *multipartBody) Read(p []byte) (int, error) {
+	b.once.Do(func() {
+		go func() {
+			b.pw.CloseWithError(b.write(b.pw, true))
+		}()
+	})
+
+	return b.pr.Read(p)
+}
+
+// Close Прерывает формирование тела запроса
+func (b *multipartBody) Close() error {
+	return b.pr.Close()
+}
+
+// contentType Возвращает Content-Type запроса (включая boundary)
+func (b *multipartBody) contentType() WContentType {
+	return WContentType("multipart/form-data; boundary=" + b.boundary)
+}
+
+// length Вычисляет итоговый размер тела запроса или возвращает -1, если размер какого-либо файла неизвестен
+func (b *multipartBody) length() int64 {
+	var size int64
+
+	for _, file := range b.files {
+		n := file.length()
+		if n < 0 {
+			return -1
+		}
+		size += n
+	}
+
+	// Размер служебной части считаем, формируя тело без содержимого файлов
+	cw := &countWriter{}
+	if err := b.write(cw, false); err != nil {
+		return -1
+	}
+
+	return cw.n + size
+}
+
+// reusable Можно ли сформировать тело запроса повторно
+func (b *multipartBody) reusable() bool {
+	for _, file := range b.files {
+		if !file.reusable() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// write Формирует multipart тело в w. При withBodies == false содержимое файлов пропускается
+func (b *multipartBody) write(w io.Writer, withBodies bool) error {
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(b.boundary); err != nil {
+		return err
+	}
+
+	// Ключи сортируются, чтобы порядок полей не зависел от обхода map
+	keys := make([]string, 0, len(b.fields))
+	for key := range b.fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		for _, v := range b.fields[key] {
+			fw, err := mw.CreateFormField(key)
+			if err != nil {
+				return err
+			}
+
+			if _, err := fw.Write([]byte(v)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, file := range b.files {
+		fw, err := mw.CreatePart(fileHeader(file))
+		if err != nil {
+			return err
+		}
+
+		if !withBodies {
+			continue
+		}
+
+		rc, err := file.open()
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(fw, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return mw.Close()
+}
+
+// fileHeader Формирует заголовки части multipart запроса для файла
+func fileHeader(file File) textproto.MIMEHeader {
+	// Content-Type определяется заранее в File.withContentType,
+	// application/octet-stream остается на случай, если определить его не удалось
+	ctype := file.ContentType
+	if len(ctype) == 0 {
+		ctype = "application/octet-stream"
+	}
+
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+		quoteEscaper.Replace(file.Param), quoteEscaper.Replace(file.Name)))
+	h.Set("Content-Type", ctype)
+
+	return h
+}
@@ -0,0 +1,242 @@
+package webclient
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Option Настройка клиента, применяемая в New и With
+type Option func(w *Webclient)
+
+// With Возвращает новый клиент с примененными настройками, исходный клиент не изменяется.
+// Новый клиент использует тот же пул соединений, если opts не меняют транспорт (WithProxy, WithTLS, WithTransport и т.д.),
+// и те же хранилище кэша, ограничения частоты и одновременных запросов и circuit breaker, если opts не меняют
+// их настройки (WithCache, WithRateLimit, WithCircuitBreaker и т.д.)
+func (w *Webclient) With(opts ...Option) *Webclient {
+	derived := w.clone()
+	for _, opt := range opts {
+		opt(derived)
+	}
+
+	// Цепочка транспортов сброшена опциями -> строим ее заново
+	if derived.client.Transport == nil {
+		derived.config.wrapTransport(derived)
+	}
+
+	return derived
+}
+
+// WithHeader Устанавливает заголовок для всех запросов клиента. Заголовки запроса имеют приоритет
+func WithHeader(header string, value string) Option {
+	return func(w *Webclient) {
+		w.headers[header] = value
+	}
+}
+
+// WithHeaders Устанавливает множество заголовков для всех запросов клиента
+func WithHeaders(headers map[string]string) Option {
+	return func(w *Webclient) {
+		for key, value := range headers {
+			w.headers[key] = value
+		}
+	}
+}
+
+// WithBasicAuth Устанавливает Basic авторизацию для всех запросов клиента
+func WithBasicAuth(username string, password string) Option {
+	credentials := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	return WithHeader("Authorization", "Basic "+credentials)
+}
+
+// WithBearerToken Устанавливает авторизацию по токену (Authorization: Bearer) для всех запросов клиента
+func WithBearerToken(token string) Option {
+	return WithHeader("Authorization", "Bearer "+token)
+}
+
+// WithTimeout Устанавливает ограничение времени выполнения запроса, включая чтение тела ответа (0 - без ограничения)
+func WithTimeout(timeout time.Duration) Option {
+	return func(w *Webclient) {
+		w.client.Timeout = timeout
+	}
+}
+
+// WithCookieJar Устанавливает хранилище кук (NewJar или любое другое http.CookieJar, nil - куки не сохраняются)
+func WithCookieJar(jar http.CookieJar) Option {
+	return func(w *Webclient) {
+		w.client.Jar = jar
+	}
+}
+
+// WithFollowRedirect Включает или отключает переход по редиректам
+func WithFollowRedirect(follow bool) Option {
+	if follow {
+		return WithRedirectPolicy(nil)
+	}
+
+	return WithRedirectPolicy(func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	})
+}
+
+// WithRedirectPolicy Устанавливает политику редиректов (см. http.Client.CheckRedirect, nil - политика по умолчанию)
+func WithRedirectPolicy(policy func(req *http.Request, via []*http.Request) error) Option {
+	return func(w *Webclient) {
+		w.client.CheckRedirect = policy
+	}
+}
+
+// withTransportTimeout Ограничивает время установки соединения, TLS рукопожатия и ожидания заголовков ответа
+func withTransportTimeout(timeout time.Duration) Option {
+	return func(w *Webclient) {
+		w.updateTransport(func(transport *http.Transport) {
+			transport.TLSHandshakeTimeout = timeout
+			transport.ResponseHeaderTimeout = timeout
+			transport.DialContext = (&net.Dialer{
+				Timeout:   timeout,
+				KeepAlive: 120 * time.Second,
+			}).DialContext
+		})
+	}
+}
+
+// WithKeepAlive Включает или отключает переиспользование соединений. Действует, только если транспорт клиента - *http.Transport
+func WithKeepAlive(keepAlive bool) Option {
+	return func(w *Webclient) {
+		w.updateTransport(func(transport *http.Transport) {
+			transport.DisableKeepAlives = !keepAlive
+		})
+	}
+}
+
+// WithTLS Устанавливает настройки TLS. Действует, только если транспорт клиента - *http.Transport
+func WithTLS(config *tls.Config) Option {
+	return func(w *Webclient) {
+		w.updateTransport(func(transport *http.Transport) {
+			transport.TLSClientConfig = config
+		})
+	}
+}
+
+// WithProxy Отправляет запросы через прокси. Повторные вызовы с тем же прокси используют один пул соединений.
+// Действует, только если транспорт клиента - *http.Transport, иначе опция игнорируется (с записью в лог).
+// Чтобы получить ошибку вместо этого, используйте Webclient.ProxyClient
+func WithProxy(proxyURL string) Option {
+	return func(w *Webclient) {
+		if err := w.setProxy(proxyURL); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// WithDialer Устанавливает соединения через dialer. Действует, только если транспорт клиента - *http.Transport.
+// Клиент получает собственный пул соединений, который закрывается через CloseIdleConnections
+func WithDialer(dialer func(ctx context.Context, network string, addr string) (net.Conn, error)) Option {
+	return func(w *Webclient) {
+		w.updateTransport(func(transport *http.Transport) {
+			transport.DialContext = dialer
+		})
+	}
+}
+
+// WithTransport Устанавливает транспорт, поверх которого строится цепочка транспортов клиента
+// (кэш, ограничения запросов, circuit breaker). Транспорт должен самостоятельно распаковывать ответы
+// или не запрашивать сжатие, если это *http.Transport с включенной компрессией
+func WithTransport(transport http.RoundTripper) Option {
+	return func(w *Webclient) {
+		w.setTransport(transport)
+	}
+}
+
+// WithHTTPClient Использует настройки client (Jar, Timeout, CheckRedirect) и его транспорт, если он задан.
+// Сам client не изменяется
+func WithHTTPClient(client *http.Client) Option {
+	return func(w *Webclient) {
+		copied := *client
+		copied.Transport = w.client.Transport
+		w.client = &copied
+
+		if client.Transport != nil {
+			WithTransport(client.Transport)(w)
+		}
+	}
+}
+
+// WithCache Устанавливает хранилище для кэша GET ответов (nil - кэш не используется)
+func WithCache(storage CacheStorage) Option {
+	return func(w *Webclient) {
+		w.updateConfig(func(config *Config) { config.Cache = storage })
+	}
+}
+
+// WithRateLimit Ограничивает частоту всех запросов клиента
+func WithRateLimit(limit RateLimit) Option {
+	return func(w *Webclient) {
+		w.updateConfig(func(config *Config) { config.RateLimit = limit })
+	}
+}
+
+// WithPerHostRateLimit Ограничивает частоту запросов к каждому хосту в отдельности
+func WithPerHostRateLimit(limit RateLimit) Option {
+	return func(w *Webclient) {
+		w.updateConfig(func(config *Config) { config.PerHostRateLimit = limit })
+	}
+}
+
+// WithHostRateLimit Ограничивает частоту запросов к хосту (имя без порта), имеет приоритет над WithPerHostRateLimit
+func WithHostRateLimit(host string, limit RateLimit) Option {
+	return func(w *Webclient) {
+		w.updateConfig(func(config *Config) {
+			// Карта может быть общей с клиентом, от которого создан этот
+			limits := make(map[string]RateLimit, len(config.HostRateLimits)+1)
+			for h, l := range config.HostRateLimits {
+				limits[h] = l
+			}
+			limits[host] = limit
+			config.HostRateLimits = limits
+		})
+	}
+}
+
+// WithAdaptiveRateLimit Замедляет запросы по заголовкам X-RateLimit-*, RateLimit-* и Retry-After.
+// onThrottle (может быть nil) вызывается, когда запросы к хосту начинают замедляться
+func WithAdaptiveRateLimit(onThrottle func(Throttle)) Option {
+	return func(w *Webclient) {
+		w.updateConfig(func(config *Config) {
+			config.AdaptiveRateLimit = true
+			config.OnThrottle = onThrottle
+		})
+	}
+}
+
+// WithMaxConcurrent Ограничивает количество одновременно выполняемых запросов клиента (0 - без ограничения)
+func WithMaxConcurrent(n int) Option {
+	return func(w *Webclient) {
+		w.updateConfig(func(config *Config) { config.MaxConcurrent = n })
+	}
+}
+
+// WithMaxConcurrentPerHost Ограничивает количество одновременно выполняемых запросов к каждому хосту (0 - без ограничения)
+func WithMaxConcurrentPerHost(n int) Option {
+	return func(w *Webclient) {
+		w.updateConfig(func(config *Config) { config.MaxConcurrentPerHost = n })
+	}
+}
+
+// WithBulkheadFailFast Не ждать освобождения места при ограничении одновременных запросов, а сразу возвращать ErrBulkheadFull
+func WithBulkheadFailFast(failFast bool) Option {
+	return func(w *Webclient) {
+		w.updateConfig(func(config *Config) { config.BulkheadFailFast = failFast })
+	}
+}
+
+// WithCircuitBreaker Прекращает запросы к хосту, который отвечает ошибками
+func WithCircuitBreaker(breaker CircuitBreaker) Option {
+	return func(w *Webclient) {
+		w.updateConfig(func(config *Config) { config.CircuitBreaker = breaker })
+	}
+}
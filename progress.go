@@ -0,0 +1,63 @@
+package webclient
+
+import (
+	"io"
+	"time"
+)
+
+// ProgressFunc Функция для отслеживания прогресса передачи данных.
+// current - количество переданных байт, total - общий размер или -1, если он неизвестен
+type ProgressFunc func(current int64, total int64)
+
+// progressReader Обертка над io.ReadCloser, сообщающая о прогрессе чтения.
+// При заданном interval сообщает не чаще одного раза за интервал, последнее значение сообщается всегда
+type progressReader struct {
+	rc       io.ReadCloser
+	fn       ProgressFunc
+	total    int64
+	current  int64
+	interval time.Duration
+	last     time.Time
+	done     bool
+}
+
+// newProgressReader Оборачивает rc для отслеживания прогресса
+func newProgressReader(rc io.ReadCloser, total int64, interval time.Duration, fn ProgressFunc) *progressReader {
+	if total <= 0 {
+		total = -1
+	}
+
+	return &progressReader{rc: rc, fn: fn, total: total, interval: interval}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.rc.Read(b)
+	p.current += int64(n)
+
+	// Транспорт может не дочитывать тело до io.EOF, если размер известен заранее
+	if err == io.EOF || (p.total > 0 && p.current >= p.total) {
+		p.finish()
+		return n, err
+	}
+
+	if n > 0 && (p.interval <= 0 || time.Since(p.last) >= p.interval) {
+		p.last = time.Now()
+		p.fn(p.current, p.total)
+	}
+
+	return n, err
+}
+
+func (p *progressReader) Close() error {
+	return p.rc.Close()
+}
+
+// finish Сообщает итоговый прогресс (один раз)
+func (p *progressReader) finish() {
+	if p.done {
+		return
+	}
+
+	p.done = true
+	p.fn(p.current, p.total)
+}
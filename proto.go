@@ -0,0 +1,72 @@
+package webclient
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ProtoMessage Protobuf-сообщение. Интерфейсу соответствуют сообщения, сгенерированные protoc-gen-go
+// (github.com/golang/protobuf, google.golang.org/protobuf) и gogo/protobuf
+type ProtoMessage interface {
+	Reset()
+	String() string
+	ProtoMessage()
+}
+
+// protoCodec Кодек по умолчанию для application/x-protobuf. Работает только с сообщениями,
+// которые умеют сериализовать себя сами (gogo/protobuf, vtprotobuf): библиотека не зависит от google.golang.org/protobuf.
+// Для сообщений google.golang.org/protobuf (и github.com/golang/protobuf) без RegisterProtoCodec
+// Marshal и Unmarshal возвращают ErrCodecNotFound
+type protoCodec struct{}
+
+func (protoCodec) Marshal(v interface{}) ([]byte, error) {
+	switch m := v.(type) {
+	case interface{ MarshalVT() ([]byte, error) }:
+		return m.MarshalVT()
+	case interface{ Marshal() ([]byte, error) }:
+		return m.Marshal()
+	}
+
+	return nil, fmt.Errorf("%w: %s for %T, use RegisterProtoCodec", ErrCodecNotFound, TypeProtobuf, v)
+}
+
+func (protoCodec) Unmarshal(data []byte, v interface{}) error {
+	switch m := v.(type) {
+	case interface{ UnmarshalVT([]byte) error }:
+		return m.UnmarshalVT(data)
+	case interface{ Unmarshal([]byte) error }:
+		return m.Unmarshal(data)
+	}
+
+	return fmt.Errorf("%w: %s for %T, use RegisterProtoCodec", ErrCodecNotFound, TypeProtobuf, v)
+}
+
+var protoCodecs = struct {
+	sync.RWMutex
+	m map[WContentType]Codec
+}{
+	m: map[WContentType]Codec{
+		TypeProtobuf:           protoCodec{},
+		"application/protobuf": protoCodec{},
+	},
+}
+
+// RegisterProtoCodec Регистрирует кодек, который используется для ProtoMessage вместо обычного кодека Content-Type.
+// Например, proto.Marshal/proto.Unmarshal для TypeProtobuf и protojson для TypeJSON (JSON-маппинг protobuf)
+func RegisterProtoCodec(ctype WContentType, codec Codec) {
+	protoCodecs.Lock()
+	defer protoCodecs.Unlock()
+
+	protoCodecs.m[normalizeContentType(string(ctype))] = codec
+}
+
+// SendProto Отправляет protobuf-сообщение. По умолчанию используется application/x-protobuf.
+// С ContentType(TypeJSON) сообщение сериализуется кодеком, зарегистрированным через RegisterProtoCodec(TypeJSON, ...)
+// (например, на основе protojson). Без него Do возвращает ErrCodecNotFound: encoding/json
+// не соблюдает JSON-маппинг protobuf, который ожидает grpc-gateway
+func (r *Request) SendProto(msg ProtoMessage) *Request {
+	r.cStruct = msg
+	r.ctype = TypeProtobuf
+
+	return r
+}
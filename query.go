@@ -0,0 +1,97 @@
+package webclient
+
+import (
+	"net/url"
+	"strings"
+)
+
+// QueryMergePolicy Определяет, как данные из Query/QueryParam объединяются с параметрами, уже указанными в URL
+type QueryMergePolicy int
+
+const (
+	// QueryAppend Значения добавляются к уже существующим параметрам URL (по умолчанию)
+	QueryAppend QueryMergePolicy = iota
+	// QueryReplace Параметры из Query/QueryParam заменяют одноименные параметры URL
+	QueryReplace
+)
+
+// queryPair Пара ключ-значение из query-строки вместе с исходным (закодированным) представлением
+type queryPair struct {
+	key   string
+	value string
+	raw   string
+}
+
+// parseQueryPairs Разбирает query-строку с сохранением порядка параметров.
+// В отличие от url.ParseQuery не прерывается на некорректных парах, а оставляет их как есть
+func parseQueryPairs(rawQuery string) []queryPair {
+	pairs := make([]queryPair, 0)
+
+	for _, raw := range strings.Split(rawQuery, "&") {
+		if len(raw) == 0 {
+			continue
+		}
+
+		key, value := raw, ""
+		if i := strings.Index(raw, "="); i >= 0 {
+			key, value = raw[:i], raw[i+1:]
+		}
+
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+
+		if v, err := url.QueryUnescape(value); err == nil {
+			value = v
+		}
+
+		pairs = append(pairs, queryPair{key: key, value: value, raw: raw})
+	}
+
+	return pairs
+}
+
+// mergeQuery Объединяет query-строку URL с данными запроса согласно политике policy.
+// keys задает порядок добавления новых параметров и используется только при keepOrder
+func mergeQuery(rawQuery string, data map[string][]string, keys []string, policy QueryMergePolicy, keepOrder bool) string {
+	// Если добавлять нечего -> оставляем исходную строку нетронутой
+	if len(data) == 0 {
+		return rawQuery
+	}
+
+	pairs := parseQueryPairs(rawQuery)
+
+	if !keepOrder {
+		values := url.Values{}
+		for _, p := range pairs {
+			if _, ok := data[p.key]; ok && policy == QueryReplace {
+				continue
+			}
+			values.Add(p.key, p.value)
+		}
+
+		for key, vals := range data {
+			for _, v := range vals {
+				values.Add(key, v)
+			}
+		}
+
+		return values.Encode()
+	}
+
+	parts := make([]string, 0, len(pairs)+len(data))
+	for _, p := range pairs {
+		if _, ok := data[p.key]; ok && policy == QueryReplace {
+			continue
+		}
+		parts = append(parts, p.raw)
+	}
+
+	for _, key := range keys {
+		for _, v := range data[key] {
+			parts = append(parts, url.QueryEscape(key)+"="+url.QueryEscape(v))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
@@ -0,0 +1,175 @@
+package webclient
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RateLimit Ограничение частоты запросов (token bucket). Нулевое значение - без ограничений
+type RateLimit struct {
+	// Количество запросов в секунду
+	RPS float64
+	// Максимальное количество запросов, которое можно выполнить подряд без ожидания. По умолчанию 1
+	Burst int
+}
+
+// enabled Задано ли ограничение
+func (l RateLimit) enabled() bool {
+	return l.RPS > 0
+}
+
+// tokenBucket Реализация token bucket. Токены резервируются заранее, поэтому ожидающие запросы
+// выстраиваются в очередь, а не конкурируют за освободившийся токен
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket Создает token bucket с полным запасом токенов
+func newTokenBucket(limit RateLimit) *tokenBucket {
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &tokenBucket{rate: limit.RPS, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// reserve Резервирует токен и возвращает время, которое необходимо подождать до его появления
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel Возвращает зарезервированный токен (если запрос так и не был отправлен)
+func (b *tokenBucket) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens++
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// wait Ожидает появления токена с учетом отмены контекста запроса
+func (b *tokenBucket) wait(req *http.Request) error {
+	delay := b.reserve()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-req.Context().Done():
+		b.cancel()
+		return req.Context().Err()
+	}
+}
+
+// rateLimitTransport http.RoundTripper, ограничивающий частоту запросов глобально и для каждого хоста,
+// а также (при AdaptiveRateLimit) по заголовкам лимитов из ответов сервера
+type rateLimitTransport struct {
+	next       http.RoundTripper
+	global     *tokenBucket
+	perHost    RateLimit
+	hostLimits map[string]RateLimit
+	adaptive   *adaptiveLimiter
+
+	mu    sync.Mutex
+	hosts map[string]*tokenBucket
+}
+
+// newRateLimitTransport Оборачивает next в транспорт с ограничением частоты запросов
+func newRateLimitTransport(next http.RoundTripper, global RateLimit, perHost RateLimit, hostLimits map[string]RateLimit) *rateLimitTransport {
+	t := &rateLimitTransport{
+		next:       next,
+		perHost:    perHost,
+		hostLimits: make(map[string]RateLimit, len(hostLimits)),
+		hosts:      make(map[string]*tokenBucket),
+	}
+
+	if global.enabled() {
+		t.global = newTokenBucket(global)
+	}
+
+	for host, limit := range hostLimits {
+		t.hostLimits[host] = limit
+	}
+
+	return t
+}
+
+// RoundTrip Ожидает разрешения лимитов и выполняет запрос
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if bucket := t.hostBucket(req.URL.Hostname()); bucket != nil {
+		if err := bucket.wait(req); err != nil {
+			return nil, err
+		}
+	}
+
+	if t.adaptive != nil {
+		if err := t.adaptive.wait(req); err != nil {
+			return nil, err
+		}
+	}
+
+	if t.global != nil {
+		if err := t.global.wait(req); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err == nil && t.adaptive != nil {
+		t.adaptive.observe(req, resp)
+	}
+
+	return resp, err
+}
+
+// hostBucket Возвращает token bucket хоста или nil, если для хоста нет ограничений
+func (t *rateLimitTransport) hostBucket(host string) *tokenBucket {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if bucket, ok := t.hosts[host]; ok {
+		return bucket
+	}
+
+	limit, ok := t.hostLimits[host]
+	if !ok {
+		limit = t.perHost
+	}
+
+	if !limit.enabled() {
+		return nil
+	}
+
+	bucket := newTokenBucket(limit)
+	t.hosts[host] = bucket
+
+	return bucket
+}
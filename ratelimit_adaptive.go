@@ -0,0 +1,215 @@
+package webclient
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Throttle Сведения о замедлении запросов к хосту по заголовкам ответа сервера
+type Throttle struct {
+	Host string
+	// Запросы к хосту приостановлены до этого момента
+	Until time.Time
+	// Минимальный интервал между запросами, если лимит сервера почти исчерпан
+	Interval time.Duration
+	// Заголовок, по которому принято решение
+	Reason string
+}
+
+// adaptiveHost Состояние замедления запросов к хосту
+type adaptiveHost struct {
+	pausedUntil   time.Time
+	interval      time.Duration
+	intervalUntil time.Time
+	next          time.Time
+}
+
+// adaptiveLimiter Замедляет запросы к хостам согласно X-RateLimit-*, RateLimit-* (IETF draft) и Retry-After
+type adaptiveLimiter struct {
+	onThrottle func(Throttle)
+
+	mu    sync.Mutex
+	hosts map[string]*adaptiveHost
+}
+
+// newAdaptiveLimiter Создает adaptiveLimiter. onThrottle может быть nil
+func newAdaptiveLimiter(onThrottle func(Throttle)) *adaptiveLimiter {
+	return &adaptiveLimiter{onThrottle: onThrottle, hosts: make(map[string]*adaptiveHost)}
+}
+
+// wait Ожидает, пока запрос к хосту будет разрешен, с учетом отмены контекста запроса
+func (l *adaptiveLimiter) wait(req *http.Request) error {
+	l.mu.Lock()
+	state, ok := l.hosts[req.URL.Hostname()]
+	if !ok {
+		l.mu.Unlock()
+		return nil
+	}
+
+	now := time.Now()
+	start := now
+	if state.pausedUntil.After(start) {
+		start = state.pausedUntil
+	}
+
+	// Пока действует интервал, запросы выстраиваются в очередь с шагом interval
+	if start.Before(state.intervalUntil) {
+		if state.next.After(start) {
+			start = state.next
+		}
+		state.next = start.Add(state.interval)
+	}
+	l.mu.Unlock()
+
+	delay := start.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
+
+// observe Обновляет состояние хоста по заголовкам ответа
+func (l *adaptiveLimiter) observe(req *http.Request, resp *http.Response) {
+	now := time.Now()
+	throttle := Throttle{Host: req.URL.Hostname()}
+
+	if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), now); ok &&
+		(resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+		throttle.Until = now.Add(retryAfter)
+		throttle.Reason = "Retry-After"
+	} else if limit, remaining, reset, reason, ok := parseRateLimitHeaders(resp.Header, now); ok {
+		// Замедляемся, только когда лимит почти исчерпан (осталось не больше 10%)
+		threshold := int64(10)
+		if limit > 0 {
+			threshold = limit / 10
+		}
+
+		switch {
+		case remaining <= 0 && reset > 0:
+			throttle.Until = now.Add(reset)
+		case remaining <= threshold && reset > 0:
+			throttle.Interval = reset / time.Duration(remaining)
+			throttle.Until = now.Add(reset)
+		default:
+			return
+		}
+		throttle.Reason = reason
+	} else {
+		return
+	}
+
+	l.mu.Lock()
+	state, ok := l.hosts[throttle.Host]
+	if !ok {
+		state = &adaptiveHost{}
+		l.hosts[throttle.Host] = state
+	}
+
+	notify := false
+	if throttle.Interval > 0 {
+		notify = !now.Before(state.intervalUntil)
+		state.interval = throttle.Interval
+		state.intervalUntil = throttle.Until
+	} else {
+		notify = !state.pausedUntil.After(now)
+		if throttle.Until.After(state.pausedUntil) {
+			state.pausedUntil = throttle.Until
+		}
+	}
+	l.mu.Unlock()
+
+	// Сообщаем только о начале замедления, а не о каждом ответе
+	if notify && l.onThrottle != nil {
+		l.onThrottle(throttle)
+	}
+}
+
+// parseRetryAfter Разбирает Retry-After: количество секунд или HTTP дата
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return 0, false
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return date.Sub(now), true
+	}
+
+	return 0, false
+}
+
+// parseRateLimitHeaders Разбирает заголовки лимитов сервера. Поддерживаются
+// RateLimit: limit=100, remaining=10, reset=30 (или r=10;t=30), RateLimit-Limit/Remaining/Reset
+// и X-RateLimit-Limit/Remaining/Reset (Reset - секунды или unix-время)
+func parseRateLimitHeaders(header http.Header, now time.Time) (limit int64, remaining int64, reset time.Duration, reason string, ok bool) {
+	if value := header.Get("RateLimit"); len(value) > 0 {
+		params := make(map[string]string)
+		for _, part := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' }) {
+			if i := strings.Index(part, "="); i >= 0 {
+				params[strings.ToLower(strings.TrimSpace(part[:i]))] = strings.Trim(strings.TrimSpace(part[i+1:]), `"`)
+			}
+		}
+
+		remainingValue, hasRemaining := params["remaining"]
+		if !hasRemaining {
+			remainingValue, hasRemaining = params["r"]
+		}
+
+		resetValue, hasReset := params["reset"]
+		if !hasReset {
+			resetValue = params["t"]
+		}
+
+		if hasRemaining {
+			return parseRateLimitValues(params["limit"], remainingValue, resetValue, now, "RateLimit")
+		}
+	}
+
+	for _, prefix := range []string{"RateLimit-", "X-RateLimit-"} {
+		if remainingValue := header.Get(prefix + "Remaining"); len(remainingValue) > 0 {
+			return parseRateLimitValues(header.Get(prefix+"Limit"), remainingValue, header.Get(prefix+"Reset"), now, prefix+"Remaining")
+		}
+	}
+
+	return 0, 0, 0, "", false
+}
+
+// parseRateLimitValues Разбирает значения лимита, остатка и времени сброса
+func parseRateLimitValues(limitValue string, remainingValue string, resetValue string, now time.Time, reason string) (int64, int64, time.Duration, string, bool) {
+	remaining, err := strconv.ParseInt(strings.TrimSpace(remainingValue), 10, 64)
+	if err != nil {
+		return 0, 0, 0, "", false
+	}
+
+	// Limit может содержать политику после ";" (10, 10;w=1)
+	limitValue = strings.SplitN(limitValue, ";", 2)[0]
+	limit, _ := strconv.ParseInt(strings.TrimSpace(limitValue), 10, 64)
+
+	var reset time.Duration
+	if value, err := strconv.ParseInt(strings.TrimSpace(resetValue), 10, 64); err == nil && value > 0 {
+		// Большие значения - unix-время (как у GitHub), остальные - количество секунд
+		if value > 1000000000 {
+			reset = time.Unix(value, 0).Sub(now)
+		} else {
+			reset = time.Duration(value) * time.Second
+		}
+	}
+
+	return limit, remaining, reset, reason, true
+}
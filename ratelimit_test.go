@@ -0,0 +1,127 @@
+package webclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	cases := []struct {
+		name   string
+		config Config
+	}{
+		{"global", Config{RateLimit: RateLimit{RPS: 20, Burst: 1}}},
+		{"per-host", Config{PerHostRateLimit: RateLimit{RPS: 20, Burst: 1}}},
+		{"host", Config{HostRateLimits: map[string]RateLimit{"127.0.0.1": {RPS: 20, Burst: 1}}}},
+	}
+
+	for _, c := range cases {
+		client := c.config.New()
+
+		start := time.Now()
+		for i := 0; i < 5; i++ {
+			if _, _, err := client.Get(ts.URL).Do(); err != nil {
+				t.Errorf("%s: got unexpected error: %v", c.name, err)
+			}
+		}
+
+		// Первый запрос уходит сразу, остальные - с интервалом 50ms
+		if elapsed := time.Since(start); elapsed < 190*time.Millisecond {
+			t.Errorf("%s: requests should be limited, elapsed: %v", c.name, elapsed)
+		}
+	}
+
+	start := time.Now()
+	client := Config{HostRateLimits: map[string]RateLimit{"example.com": {RPS: 1}}}.New()
+	for i := 0; i < 5; i++ {
+		client.Get(ts.URL).Do()
+	}
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Requests to other hosts should not be limited, elapsed: %v", elapsed)
+	}
+}
+
+func TestRateLimitContext(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	client := Config{RateLimit: RateLimit{RPS: 0.1}}.New()
+	client.Get(ts.URL).Do()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, _, err := client.Get(ts.URL).WithContext(ctx).Do()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected error: %v, got: %v", context.DeadlineExceeded, err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Waiting should be interrupted by context, elapsed: %v", elapsed)
+	}
+}
+
+func TestAdaptiveRateLimit(t *testing.T) {
+	var calls int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer ts.Close()
+
+	var throttles []Throttle
+	client := Config{AdaptiveRateLimit: true, OnThrottle: func(th Throttle) { throttles = append(throttles, th) }}.New()
+
+	resp, _, _ := client.Get(ts.URL).Do()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Expected status: %d, got: %d", http.StatusTooManyRequests, resp.StatusCode)
+	}
+
+	start := time.Now()
+	client.Get(ts.URL).Do()
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Errorf("Request should wait for Retry-After, elapsed: %v", elapsed)
+	}
+
+	if len(throttles) != 1 || throttles[0].Reason != "Retry-After" || throttles[0].Host != "127.0.0.1" {
+		t.Errorf("Unexpected throttle callbacks: %+v", throttles)
+	}
+}
+
+func TestParseRateLimitHeaders(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+
+	cases := []struct {
+		header    http.Header
+		limit     int64
+		remaining int64
+		reset     time.Duration
+		ok        bool
+	}{
+		{http.Header{"X-Ratelimit-Limit": {"5000"}, "X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"1600000060"}}, 5000, 0, time.Minute, true},
+		{http.Header{"Ratelimit-Limit": {"100"}, "Ratelimit-Remaining": {"5"}, "Ratelimit-Reset": {"30"}}, 100, 5, 30 * time.Second, true},
+		{http.Header{"Ratelimit": {"limit=100, remaining=50, reset=5"}}, 100, 50, 5 * time.Second, true},
+		{http.Header{"Ratelimit": {`"default";r=7;t=10`}}, 0, 7, 10 * time.Second, true},
+		{http.Header{}, 0, 0, 0, false},
+	}
+
+	for i, c := range cases {
+		limit, remaining, reset, _, ok := parseRateLimitHeaders(c.header, now)
+		if limit != c.limit || remaining != c.remaining || reset != c.reset || ok != c.ok {
+			t.Errorf("Case %d: got %d, %d, %v, %v", i, limit, remaining, reset, ok)
+		}
+	}
+}
@@ -5,21 +5,20 @@ package webclient
 
 import (
 	"bytes"
-	"encoding/json"
-	"encoding/xml"
-	"fmt"
+	"context"
 	"io"
 	"io/ioutil"
 	"log"
 	"mime/multipart"
 	"net/http"
-	"net/textproto"
 	"net/url"
+	"time"
 )
 
 // Request Структура содержащая все состовные части для запроса
 type Request struct {
 	client *http.Client
+	ctx    context.Context
 
 	url         string
 	ctype       WContentType
@@ -27,32 +26,92 @@ type Request struct {
 	method      string
 	cStruct     interface{}
 	rawData     string
+	rawBytes    []byte
+	bodyReader  io.Reader
+	bodySize    int64
 	headers     map[string]string
-	cookies     map[string]string
+	cookies     []*http.Cookie
 	queryData   map[string][]string
+	queryKeys   []string
+	queryMerge  QueryMergePolicy
+	queryOrder  bool
 	formData    map[string][]string
 	files       []File
+	result      interface{}
+
+	compress          string
+	compressThreshold int64
+	rawEncoding       bool
+
+	uploadProgress   ProgressFunc
+	downloadProgress ProgressFunc
+	progressInterval time.Duration
+
+	hedgeAfter time.Duration
+	hedgeMax   int
+
+	// Сессия, через которую создан запрос
+	session *Session
 }
 
-// NewRequest Создает новый Request
-func NewRequest(client *http.Client, transport *http.Transport, targetURL string, method string) *Request {
-	client.Transport = transport
+// NewRequest Создает новый Request. Переданный client не изменяется: если указан transport (любой http.RoundTripper),
+// запрос выполняется копией клиента с этим транспортом, иначе - транспортом клиента
+func NewRequest(client *http.Client, transport http.RoundTripper, targetURL string, method string) *Request {
+	if transport != nil {
+		copied := *client
+		copied.Transport = transport
+		client = &copied
+	}
+
+	return newRequest(client, targetURL, method)
+}
 
+// newRequest Создает новый Request, не изменяя транспорт клиента
+func newRequest(client *http.Client, targetURL string, method string) *Request {
 	return &Request{
 		client:    client,
+		ctx:       context.Background(),
 		url:       targetURL,
 		method:    method,
 		headers:   make(map[string]string),
-		cookies:   make(map[string]string),
 		files:     make([]File, 0),
 		queryData: make(map[string][]string),
 		formData:  make(map[string][]string),
 	}
 }
 
+// WithContext Устанавливает контекст запроса. Отмена контекста прерывает как сам запрос,
+// так и ожидание лимитов клиента (RateLimit)
+func (r *Request) WithContext(ctx context.Context) *Request {
+	r.ctx = ctx
+	return r
+}
+
 // Cookie Добавляет куку
 func (r *Request) Cookie(name string, value string) *Request {
-	r.cookies[name] = value
+	return r.AddCookie(&http.Cookie{Name: name, Value: value})
+}
+
+// AddCookie Добавляет куку. Если у куки указаны атрибуты (Expires, MaxAge, Secure, Domain, Path),
+// она отправляется, только если подходит адресу запроса. Кука с тем же именем заменяется
+func (r *Request) AddCookie(cookie *http.Cookie) *Request {
+	for i, c := range r.cookies {
+		if c.Name == cookie.Name {
+			r.cookies[i] = cookie
+			return r
+		}
+	}
+
+	r.cookies = append(r.cookies, cookie)
+	return r
+}
+
+// CookieJar Устанавливает хранилище кук только для этого запроса вместо хранилища клиента (nil - без хранилища)
+func (r *Request) CookieJar(jar http.CookieJar) *Request {
+	client := *r.client
+	client.Jar = jar
+	r.client = &client
+
 	return r
 }
 
@@ -91,41 +150,53 @@ func (r *Request) Referer(data string) *Request {
 
 // Query Устанавливает Query данные для запроса
 func (r *Request) Query(data string) *Request {
-	parsed, err := url.ParseQuery(data)
-	if err != nil {
-		log.Panic(err)
-		return r
-	}
-
-	for key, values := range parsed {
-		for _, v := range values {
-			r.queryData[key] = append(r.queryData[key], v)
-		}
-	}
-
+	r.addQueryString(data)
 	return r
 }
 
 // QueryParam Устанавливает Query данные для запроса
 func (r *Request) QueryParam(key string, value string) *Request {
-	r.queryData[key] = append(r.queryData[key], value)
+	r.addQuery(key, value)
 	return r
 }
 
-// Send Добавить данные для POSTDATA
-func (r *Request) Send(data string) *Request {
-	parsed, err := url.ParseQuery(data)
-	if err != nil {
+// QueryMerge Устанавливает политику объединения Query данных с параметрами, уже указанными в URL.
+// По умолчанию используется QueryAppend
+func (r *Request) QueryMerge(policy QueryMergePolicy) *Request {
+	r.queryMerge = policy
+	return r
+}
+
+// KeepQueryOrder Сохраняет исходный порядок параметров URL, новые параметры добавляются в конец в порядке добавления.
+// Иначе параметры сортируются по ключу
+func (r *Request) KeepQueryOrder(keep bool) *Request {
+	r.queryOrder = keep
+	return r
+}
+
+// addQuery Добавляет значение Query параметра, запоминая порядок ключей
+func (r *Request) addQuery(key string, value string) {
+	if _, ok := r.queryData[key]; !ok {
+		r.queryKeys = append(r.queryKeys, key)
+	}
+	r.queryData[key] = append(r.queryData[key], value)
+}
+
+// addQueryString Добавляет параметры из строки вида a=1&b=2 в порядке их следования
+func (r *Request) addQueryString(data string) {
+	if _, err := url.ParseQuery(data); err != nil {
 		log.Panic(err)
-		return r
+		return
 	}
 
-	for key, values := range parsed {
-		for _, v := range values {
-			r.queryData[key] = append(r.queryData[key], v)
-		}
+	for _, pair := range parseQueryPairs(data) {
+		r.addQuery(pair.key, pair.value)
 	}
+}
 
+// Send Добавить данные для POSTDATA
+func (r *Request) Send(data string) *Request {
+	r.addQueryString(data)
 	return r
 }
 
@@ -168,9 +239,42 @@ func (r *Request) SendXML(data string) *Request {
 	return r
 }
 
-// SendStruct Позволяет быстро отправлять любые структуры маршаля их в JSON\XML
+// SendStruct Позволяет быстро отправлять любые структуры маршаля их в JSON\XML.
+// Формат выбирается по ContentType (по умолчанию JSON), для других форматов необходимо зарегистрировать Codec
 func (r *Request) SendStruct(data interface{}) *Request {
 	r.cStruct = data
+	r.ctype = TypeJSON
+
+	return r
+}
+
+// Result Устанавливает структуру, в которую будет разобрано тело успешного (2xx) ответа.
+// Кодек выбирается по Content-Type ответа
+func (r *Request) Result(v interface{}) *Request {
+	r.result = v
+	return r
+}
+
+// SendBytes Отправляет data как есть. По умолчанию используется application/octet-stream,
+// свой Content-Type можно указать через ContentType
+func (r *Request) SendBytes(data []byte) *Request {
+	if data == nil {
+		data = []byte{}
+	}
+
+	r.rawBytes = data
+	r.ctype = TypeOctetStream
+
+	return r
+}
+
+// SendReader Отправляет данные из reader потоково, не загружая их в память.
+// size - размер данных, если он неизвестен необходимо передать 0 (тело уйдет chunked).
+// По умолчанию используется application/octet-stream, свой Content-Type можно указать через ContentType
+func (r *Request) SendReader(reader io.Reader, size int64) *Request {
+	r.bodyReader = reader
+	r.bodySize = size
+	r.ctype = TypeOctetStream
 
 	return r
 }
@@ -183,53 +287,83 @@ func (r *Request) SendPlain(data string) *Request {
 	return r
 }
 
+// OnUploadProgress Устанавливает функцию, получающую прогресс отправки тела запроса
+func (r *Request) OnUploadProgress(fn func(sent int64, total int64)) *Request {
+	r.uploadProgress = fn
+	return r
+}
+
+// OnDownloadProgress Устанавливает функцию, получающую прогресс загрузки тела ответа
+func (r *Request) OnDownloadProgress(fn func(received int64, total int64)) *Request {
+	r.downloadProgress = fn
+	return r
+}
+
+// ProgressInterval Ограничивает частоту вызова функций прогресса: не чаще одного раза за interval.
+// Итоговое значение передается всегда
+func (r *Request) ProgressInterval(interval time.Duration) *Request {
+	r.progressInterval = interval
+	return r
+}
+
+// Compress Сжимает тело запроса (gzip, deflate или зарегистрированный через RegisterEncoder) и устанавливает Content-Encoding.
+// Если Content-Encoding уже установлен через SetHeader, тело считается сжатым и не изменяется
+func (r *Request) Compress(encoding string) *Request {
+	r.compress = encoding
+	return r
+}
+
+// CompressThreshold Устанавливает минимальный размер тела (в байтах), начиная с которого оно сжимается.
+// Тела неизвестного размера (SendReader, потоковые файлы) сжимаются всегда
+func (r *Request) CompressThreshold(size int64) *Request {
+	r.compressThreshold = size
+	return r
+}
+
+// RawEncoding Отключает автоматическую распаковку ответа: тело возвращается как есть (например, сжатое gzip).
+// Accept-Encoding по-прежнему добавляется, для несжатого ответа укажите Accept-Encoding: identity
+func (r *Request) RawEncoding(raw bool) *Request {
+	r.rawEncoding = raw
+	return r
+}
+
 // newRequest Собирает воедино http.Request
 func (r *Request) newRequest() (*http.Request, error) {
+	// Данные формы (с CSRF токеном сессии)
+	formData := r.formData
+	if r.session != nil {
+		formData = r.session.formData(r)
+	}
+
 	var (
-		data io.Reader
-		req  *http.Request
-		err  error
+		data          io.Reader
+		multipartData *multipartBody
+		readerLength  int64
+		req           *http.Request
+		err           error
 	)
 
 	// Если имеются добавленные файлы -> используем multipart запрос
 	if len(r.files) > 0 || r.customCType == TypeMultipart {
-		buf := &bytes.Buffer{}
-		multipartWriter := multipart.NewWriter(buf)
-
-		// К multipart запросу добавляются данные из formData
-		for key, values := range r.formData {
-			for _, v := range values {
-				fw, _ := multipartWriter.CreateFormField(key)
-				fw.Write([]byte(v))
-			}
-		}
-
-		for _, file := range r.files {
-			var fw io.Writer
-			// Если указан конкретный Content-Type для файла -> Используем его
-			// Иначе -> Используем Content-Type по умолчанию (application/octet-stream)
-			if len(file.ContentType) > 0 {
-				h := make(textproto.MIMEHeader)
-				h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, file.Param, file.Name))
-				h.Set("Content-Type", file.ContentType)
-				fw, _ = multipartWriter.CreatePart(h)
-			} else {
-				fw, _ = multipartWriter.CreateFormFile(file.Param, file.Name)
+		// К multipart запросу добавляются данные из formData.
+		// Тело формируется потоково по мере отправки, файлы не загружаются в память
+		files := make([]File, len(r.files))
+		for i, file := range r.files {
+			if files[i], err = file.withContentType(); err != nil {
+				return nil, err
 			}
-
-			fw.Write(file.Data)
 		}
 
-		data = buf
-
-		multipartWriter.Close()
+		boundary := multipart.NewWriter(nil).Boundary()
+		multipartData = newMultipartBody(boundary, formData, files)
+		data = multipartData
 
 		// Указывает правильный Content-Type для multipart запроса (включая boundary)
-		r.ctype = WContentType(multipartWriter.FormDataContentType())
+		r.ctype = multipartData.contentType()
 
-	} else if len(r.formData) > 0 {
+	} else if len(formData) > 0 {
 		// Если есть formData
-		b := []byte(mapToUrlValues(r.formData).Encode())
+		b := []byte(mapToUrlValues(formData).Encode())
 		data = bytes.NewReader(b)
 		r.ctype = TypeForm
 
@@ -237,24 +371,32 @@ func (r *Request) newRequest() (*http.Request, error) {
 		// Если есть rawData (сырая строка с JSON, XML, PlainText)
 		data = bytes.NewBuffer([]byte(r.rawData))
 
+	} else if r.rawBytes != nil {
+		// Если использовался метод SendBytes
+		data = bytes.NewReader(r.rawBytes)
+
+	} else if r.bodyReader != nil {
+		// Если использовался метод SendReader
+		data = r.bodyReader
+		readerLength = r.bodySize
+
 	} else if r.cStruct != nil {
-		// Если использовался метод SendStruct
-		type marshallerFunc func(interface{}) ([]byte, error)
-
-		var marshaller marshallerFunc
-
-		switch r.customCType {
-		case TypeJSON:
-			marshaller = json.Marshal
-		case TypeXML:
-			marshaller = xml.Marshal
-		default:
-			// По умолчанию обработаем также как и JSON?
-			r.ctype = TypeJSON
-			marshaller = json.Marshal
+		// Если использовался метод SendStruct -> сериализуем кодеком, зарегистрированным для Content-Type
+		ctype := r.customCType
+		if len(ctype) == 0 {
+			// По умолчанию используется JSON (или тип, выбранный методом отправки, например SendProto)
+			if len(r.ctype) == 0 {
+				r.ctype = TypeJSON
+			}
+			ctype = r.ctype
 		}
 
-		buff, err := marshaller(r.cStruct)
+		codec, err := lookupCodec(string(ctype), r.cStruct)
+		if err != nil {
+			return nil, err
+		}
+
+		buff, err := codec.Marshal(r.cStruct)
 		if err != nil {
 			return nil, err
 		}
@@ -262,10 +404,28 @@ func (r *Request) newRequest() (*http.Request, error) {
 
 	}
 
-	if req, err = http.NewRequest(r.method, r.url, data); err != nil {
+	if req, err = http.NewRequestWithContext(r.ctx, r.method, r.url, data); err != nil {
 		return nil, err
 	}
 
+	if readerLength > 0 {
+		req.ContentLength = readerLength
+	}
+
+	if multipartData != nil {
+		// Если размеры всех файлов известны -> указываем точный Content-Length, иначе тело уйдет chunked
+		if length := multipartData.length(); length >= 0 {
+			req.ContentLength = length
+		}
+
+		// Тело без io.Reader источников можно сформировать повторно (например, при 307/308 редиректе)
+		if multipartData.reusable() {
+			req.GetBody = func() (io.ReadCloser, error) {
+				return newMultipartBody(multipartData.boundary, multipartData.fields, multipartData.files), nil
+			}
+		}
+	}
+
 	// Если установлен кастомный Content-Type -> Используем его
 	// Иначе используется тот, что определила либа (или пустой)
 	if len(r.customCType) > 0 && r.customCType != TypeMultipart {
@@ -278,37 +438,133 @@ func (r *Request) newRequest() (*http.Request, error) {
 		}
 	}
 
-	// Энкодим Query-часть запроса
-	req.URL.RawQuery = mapToUrlValues(r.queryData).Encode()
+	// Отслеживаем прогресс отправки тела запроса
+	if r.uploadProgress != nil && req.Body != nil && req.Body != http.NoBody {
+		req.Body = newProgressReader(req.Body, req.ContentLength, r.progressInterval, r.uploadProgress)
+
+		if getBody := req.GetBody; getBody != nil {
+			req.GetBody = func() (io.ReadCloser, error) {
+				body, err := getBody()
+				if err != nil {
+					return nil, err
+				}
+
+				return newProgressReader(body, req.ContentLength, r.progressInterval, r.uploadProgress), nil
+			}
+		}
+	}
+
+	// Энкодим Query-часть запроса, объединяя ее с параметрами из URL
+	req.URL.RawQuery = mergeQuery(req.URL.RawQuery, r.queryData, r.queryKeys, r.queryMerge, r.queryOrder)
 
 	// Устанавливаем хидеры
 	for k, v := range r.headers {
 		req.Header.Set(k, v)
 	}
 
+	// Заголовки сессии, Referer и CSRF токен имеют меньший приоритет, чем заголовки запроса
+	if r.session != nil {
+		r.session.prepare(req)
+	}
+
 	// Добавляем кукисы
-	for k, v := range r.cookies {
-		req.AddCookie(&http.Cookie{Name: k, Value: v})
+	for _, cookie := range r.cookies {
+		if cookieMatches(cookie, req.URL) {
+			req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+		}
+	}
+
+	// Запрашиваем сжатые ответы, распаковка выполняется в Do.
+	// При Range запросе сжатие не запрашиваем, т.к. диапазон относился бы к сжатым данным
+	if len(req.Header.Get("Accept-Encoding")) == 0 && len(req.Header.Get("Range")) == 0 {
+		req.Header.Set("Accept-Encoding", acceptEncoding())
+	}
+
+	// Сжимаем тело запроса
+	if len(r.compress) > 0 {
+		if err := compressRequest(req, r.compress, r.compressThreshold); err != nil {
+			return nil, err
+		}
 	}
 
 	return req, nil
 }
 
-// Do Выполняет запрос
-// warning: Не считывать тело запроса с resp.Body, для получения контента используется второй возвращаемый параметр
-func (r *Request) Do() (*http.Response, string, error) {
+// Stream Выполняет запрос и возвращает ответ с непрочитанным телом (распакованным, если не включен RawEncoding).
+// Тело ответа необходимо закрыть. При ошибке условного запроса возвращаются и ответ, и ошибка
+func (r *Request) Stream() (*http.Response, error) {
+	req, resp, err := r.send()
+	if err != nil {
+		return nil, err
+	}
+
+	if r.session != nil {
+		r.session.observe(resp, "", false)
+	}
+
+	// Прогресс отслеживается по данным, полученным по сети (до распаковки)
+	if r.downloadProgress != nil {
+		resp.Body = newProgressReader(resp.Body, resp.ContentLength, r.progressInterval, r.downloadProgress)
+	}
+
+	if !r.rawEncoding {
+		if err := decompressResponse(resp); err != nil {
+			return resp, err
+		}
+	}
+
+	return resp, conditionalError(req, resp)
+}
+
+// send Строит и отправляет запрос (с дублированием, если включен Hedge)
+func (r *Request) send() (*http.Request, *http.Response, error) {
+	if r.hedgeable() {
+		return r.hedge()
+	}
+
 	req, err := r.newRequest()
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 
 	resp, err := r.client.Do(req)
-	if err != nil {
+	return req, resp, err
+}
+
+// Do Выполняет запрос
+// warning: Не считывать тело запроса с resp.Body, для получения контента используется второй возвращаемый параметр
+func (r *Request) Do() (*http.Response, string, error) {
+	resp, err := r.Stream()
+	if resp == nil {
 		return nil, "", err
 	}
 	defer resp.Body.Close()
 
-	body, _ := ioutil.ReadAll(resp.Body)
+	// Ошибка чтения включает ошибки распаковки (например, обрезанный gzip)
+	body, readErr := ioutil.ReadAll(resp.Body)
+
+	if r.session != nil {
+		r.session.observe(resp, string(body), readErr == nil)
+	}
+
+	if err != nil {
+		return resp, string(body), err
+	}
+
+	if readErr != nil {
+		return resp, string(body), readErr
+	}
+
+	if r.result != nil && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		codec, err := lookupCodec(resp.Header.Get("Content-Type"), r.result)
+		if err != nil {
+			return resp, string(body), err
+		}
+
+		if err := codec.Unmarshal(body, r.result); err != nil {
+			return resp, string(body), err
+		}
+	}
 
 	return resp, string(body), nil
 }
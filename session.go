@@ -0,0 +1,326 @@
+package webclient
+
+import (
+	"html"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// CSRFExtractor Извлекает CSRF токен из ответа (body - тело ответа). Вызывается в Request.Do после чтения тела.
+// Пустая строка - токена в ответе нет, сохраненный токен не меняется
+type CSRFExtractor func(resp *http.Response, body string) string
+
+// Session Последовательность запросов от лица одного пользователя (логин -> форма -> отправка).
+// Сессия хранит свои куки, подставляет Referer последнего ответа (как браузер с политикой
+// strict-origin-when-cross-origin), заголовки по умолчанию и CSRF токен, извлеченный из предыдущих ответов. Сессия безопасна для одновременного использования,
+// но Referer и CSRF токен имеют смысл при последовательных запросах
+type Session struct {
+	client *Webclient
+	jar    *Jar
+
+	mu         sync.Mutex
+	headers    map[string]string
+	referer    string
+	csrf       string
+	csrfOrigin string
+	csrfFunc   CSRFExtractor
+	csrfHeader string
+	csrfField  string
+}
+
+// NewSession Создает сессию с собственным хранилищем кук (с тем же списком публичных суффиксов) поверх клиента.
+// Пул соединений, хранилище кэша и ограничения запросов общие с клиентом.
+// opts применяются к клиенту сессии как в With
+func (w *Webclient) NewSession(opts ...Option) *Session {
+	var publicSuffixList cookiejar.PublicSuffixList
+	if jar, ok := w.client.Jar.(*Jar); ok {
+		publicSuffixList = jar.options.PublicSuffixList
+	}
+
+	jar := NewJar(publicSuffixList)
+
+	return &Session{
+		client:  w.With(append([]Option{WithCookieJar(jar)}, opts...)...),
+		jar:     jar,
+		headers: make(map[string]string),
+	}
+}
+
+// Client Возвращает клиент сессии (с хранилищем кук сессии)
+func (s *Session) Client() *Webclient {
+	return s.client
+}
+
+// Jar Возвращает хранилище кук сессии (например, для сохранения через SaveFile)
+func (s *Session) Jar() *Jar {
+	return s.jar
+}
+
+// SetHeader Устанавливает заголовок для всех последующих запросов сессии. Заголовки запроса имеют приоритет
+func (s *Session) SetHeader(header string, value string) *Session {
+	s.mu.Lock()
+	s.headers[header] = value
+	s.mu.Unlock()
+
+	return s
+}
+
+// CSRF Устанавливает функцию извлечения CSRF токена из ответов. Токен добавляется в запросы,
+// изменяющие данные (POST, PUT, PATCH, DELETE), к тому же origin (схема, хост и порт), из ответа которого он получен:
+// в заголовок header и (для форм) в поле field.
+// Пустые header или field не используются
+func (s *Session) CSRF(extractor CSRFExtractor, header string, field string) *Session {
+	s.mu.Lock()
+	s.csrfFunc = extractor
+	s.csrfHeader = header
+	s.csrfField = field
+	s.mu.Unlock()
+
+	return s
+}
+
+// CSRFToken Возвращает текущий CSRF токен
+func (s *Session) CSRFToken() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.csrf
+}
+
+// Referer Возвращает адрес последнего ответа, который будет передан в Referer следующего запроса
+func (s *Session) Referer() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.referer
+}
+
+// Get Отправить запрос методом GET
+func (s *Session) Get(url string) *Request {
+	return s.newRequest(url, http.MethodGet)
+}
+
+// Post Отправить запрос методом POST
+func (s *Session) Post(url string) *Request {
+	return s.newRequest(url, http.MethodPost)
+}
+
+// Head Отправить запрос методом HEAD
+func (s *Session) Head(url string) *Request {
+	return s.newRequest(url, http.MethodHead)
+}
+
+// Put Отправить запрос методом PUT
+func (s *Session) Put(url string) *Request {
+	return s.newRequest(url, http.MethodPut)
+}
+
+// Delete Отправить запрос методом DELETE
+func (s *Session) Delete(url string) *Request {
+	return s.newRequest(url, http.MethodDelete)
+}
+
+// Patch Отправить запрос методом PATCH
+func (s *Session) Patch(url string) *Request {
+	return s.newRequest(url, http.MethodPatch)
+}
+
+// Options Отправить запрос методом OPTIONS
+func (s *Session) Options(url string) *Request {
+	return s.newRequest(url, http.MethodOptions)
+}
+
+// newRequest Создает Request сессии. Данные сессии подставляются при отправке (см. prepare)
+func (s *Session) newRequest(url string, method string) *Request {
+	req := s.client.newRequest(url, method)
+	req.session = s
+
+	return req
+}
+
+// prepare Добавляет в построенный запрос заголовки сессии, Referer и CSRF токен, если они не заданы в самом запросе.
+// Request не изменяется, поэтому при повторной сборке (Hedge, DoAllFailFast) подставляются актуальные данные сессии
+func (s *Session) prepare(req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, value := range s.headers {
+		setDefaultHeader(req.Header, key, value)
+	}
+
+	if referer := s.refererFor(req.URL); len(referer) > 0 {
+		setDefaultHeader(req.Header, "Referer", referer)
+	}
+
+	if len(s.csrfHeader) > 0 && s.csrfApplies(req.Method, req.URL) {
+		setDefaultHeader(req.Header, s.csrfHeader, s.csrf)
+	}
+}
+
+// formData Возвращает данные формы запроса с CSRF токеном в поле csrfField.
+// Если токен добавляется, данные копируются, чтобы не изменять Request
+func (s *Session) formData(r *Request) map[string][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.csrfField) == 0 || (len(r.formData) == 0 && len(r.files) == 0) {
+		return r.formData
+	}
+
+	if _, ok := r.formData[s.csrfField]; ok {
+		return r.formData
+	}
+
+	target, err := url.Parse(r.url)
+	if err != nil || !s.csrfApplies(r.method, target) {
+		return r.formData
+	}
+
+	form := make(map[string][]string, len(r.formData)+1)
+	for key, values := range r.formData {
+		form[key] = values
+	}
+	form[s.csrfField] = []string{s.csrf}
+
+	return form
+}
+
+// csrfApplies Нужно ли добавлять CSRF токен в запрос: только в запросы, изменяющие данные,
+// и только к origin, из ответа которого токен получен (токен одного сайта не должен уходить на другие)
+func (s *Session) csrfApplies(method string, target *url.URL) bool {
+	if len(s.csrf) == 0 || urlOrigin(target) != s.csrfOrigin {
+		return false
+	}
+
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+
+	return false
+}
+
+// observe Запоминает адрес ответа для Referer и извлекает CSRF токен (body пустой, если тело не читалось)
+func (s *Session) observe(resp *http.Response, body string, extract bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if resp.Request != nil && resp.Request.URL != nil {
+		referer := *resp.Request.URL
+		referer.User = nil
+		referer.Fragment = ""
+		s.referer = referer.String()
+	}
+
+	if extract && s.csrfFunc != nil && resp.Request != nil && resp.Request.URL != nil {
+		if token := s.csrfFunc(resp, body); len(token) > 0 {
+			s.csrf = token
+			s.csrfOrigin = urlOrigin(resp.Request.URL)
+		}
+	}
+}
+
+// refererFor Значение Referer для запроса к target по политике strict-origin-when-cross-origin:
+// полный адрес для того же origin, только origin для другого и ничего при переходе с https на http
+func (s *Session) refererFor(target *url.URL) string {
+	if len(s.referer) == 0 {
+		return ""
+	}
+
+	referer, err := url.Parse(s.referer)
+	if err != nil {
+		return ""
+	}
+
+	switch {
+	case urlOrigin(referer) == urlOrigin(target):
+		return s.referer
+	case referer.Scheme == "https" && target.Scheme != "https":
+		return ""
+	}
+
+	return urlOrigin(referer) + "/"
+}
+
+// urlOrigin Возвращает origin адреса: схема, хост и порт (порт по умолчанию опускается)
+func urlOrigin(u *url.URL) string {
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+
+	port := u.Port()
+	if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		port = ""
+	}
+
+	if len(port) > 0 {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+
+	return scheme + "://" + host
+}
+
+// setDefaultHeader Устанавливает заголовок, если он еще не задан
+func setDefaultHeader(header http.Header, key string, value string) {
+	if len(header.Values(key)) == 0 {
+		header.Set(key, value)
+	}
+}
+
+// CSRFFromCookie Извлекает CSRF токен из куки name, установленной ответом (double submit cookie)
+func CSRFFromCookie(name string) CSRFExtractor {
+	return func(resp *http.Response, body string) string {
+		for _, cookie := range resp.Cookies() {
+			if cookie.Name == name {
+				if value, err := url.QueryUnescape(cookie.Value); err == nil {
+					return value
+				}
+				return cookie.Value
+			}
+		}
+
+		return ""
+	}
+}
+
+// CSRFFromHeader Извлекает CSRF токен из заголовка ответа
+func CSRFFromHeader(header string) CSRFExtractor {
+	return func(resp *http.Response, body string) string {
+		return resp.Header.Get(header)
+	}
+}
+
+var (
+	htmlTagRe  = regexp.MustCompile(`(?i)<(?:input|meta)\b[^>]*>`)
+	htmlAttrRe = regexp.MustCompile(`([\w-]+)\s*=\s*("[^"]*"|'[^']*'|[^\s"'>]+)`)
+)
+
+// CSRFFromHTML Извлекает CSRF токен из HTML: <input name="name" value="..."> или <meta name="name" content="...">
+func CSRFFromHTML(name string) CSRFExtractor {
+	return func(resp *http.Response, body string) string {
+		for _, tag := range htmlTagRe.FindAllString(body, -1) {
+			attrs := make(map[string]string)
+			for _, attr := range htmlAttrRe.FindAllStringSubmatch(tag, -1) {
+				attrs[strings.ToLower(attr[1])] = html.UnescapeString(strings.Trim(attr[2], `"'`))
+			}
+
+			if attrs["name"] != name {
+				continue
+			}
+
+			if value, ok := attrs["value"]; ok {
+				return value
+			}
+
+			return attrs["content"]
+		}
+
+		return ""
+	}
+}
@@ -0,0 +1,188 @@
+package webclient
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSession(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			if r.Method == http.MethodGet {
+				w.Write([]byte(`<form><input type="hidden" name="csrf_token" value="t&amp;1"></form>`))
+				return
+			}
+
+			r.ParseForm()
+			if r.PostForm.Get("csrf_token") != "t&1" || r.Header.Get("Referer") != ts.URL+"/login" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "42", Path: "/"})
+			w.Write([]byte(`<meta name="csrf_token" content="t2">`))
+		case "/submit":
+			cookie, err := r.Cookie("session")
+			if err != nil || cookie.Value != "42" || r.Header.Get("X-CSRF-Token") != "t2" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			w.Write([]byte(r.Header.Get("X-Client") + "|" + r.Header.Get("Referer")))
+		}
+	}))
+	defer ts.Close()
+
+	client := New()
+	session := client.NewSession().
+		SetHeader("X-Client", "bot").
+		CSRF(CSRFFromHTML("csrf_token"), "X-CSRF-Token", "csrf_token")
+
+	if _, _, err := session.Get(ts.URL + "/login").Do(); err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	if token := session.CSRFToken(); token != "t&1" {
+		t.Errorf("Expected: %s, got: %s", "t&1", token)
+	}
+
+	resp, _, err := session.Post(ts.URL+"/login").SendParam("user", "admin").Do()
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Login failed: %v %v", resp.StatusCode, err)
+	}
+
+	resp, body, err := session.Post(ts.URL + "/submit").SendJSON(`{}`).Do()
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Submit failed: %v %v", resp.StatusCode, err)
+	}
+
+	if expected := "bot|" + ts.URL + "/login"; body != expected {
+		t.Errorf("Expected: %s, got: %s", expected, body)
+	}
+
+	// Куки сессии не попадают в клиент и другие сессии
+	if cookies, _ := client.Cookies(ts.URL); len(cookies) != 0 {
+		t.Errorf("Session cookies should not leak to the client, got: %v", cookies)
+	}
+
+	if cookies := session.Jar().Cookies(resp.Request.URL); len(cookies) != 1 {
+		t.Errorf("Expected session cookie, got: %v", cookies)
+	}
+
+	if resp, _, _ := client.NewSession().Post(ts.URL + "/submit").Do(); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected: %d, got: %d", http.StatusForbidden, resp.StatusCode)
+	}
+}
+
+func TestSession_CrossOrigin(t *testing.T) {
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-CSRF-Token", "secret")
+		w.Write([]byte(r.Header.Get("Referer") + "|" + r.Header.Get("X-CSRF-Token")))
+	})
+
+	site := httptest.NewTLSServer(echo)
+	defer site.Close()
+
+	other := httptest.NewTLSServer(echo)
+	defer other.Close()
+
+	plain := httptest.NewServer(echo)
+	defer plain.Close()
+
+	session := New(WithTLS(&tls.Config{InsecureSkipVerify: true})).NewSession().
+		CSRF(CSRFFromHeader("X-CSRF-Token"), "X-CSRF-Token", "")
+
+	cases := []struct {
+		url      string
+		expected string
+	}{
+		// Токен получен от site и отправляется только на site, Referer того же origin - полный адрес
+		{site.URL + "/page?q=1", "|"},
+		{site.URL + "/submit", site.URL + "/page?q=1|secret"},
+		// На другой origin передается только origin страницы и не передается токен
+		{other.URL + "/submit", site.URL + "/|"},
+		// С https на http Referer не передается
+		{plain.URL + "/submit", "|"},
+	}
+
+	for i, c := range cases {
+		_, body, err := session.Post(c.url).Do()
+		if err != nil {
+			t.Fatalf("Case %d: got unexpected error: %v", i, err)
+		}
+
+		if body != c.expected {
+			t.Errorf("Case %d: expected: %s, got: %s", i, c.expected, body)
+		}
+
+		// Следующий запрос уходит со страницы site
+		if _, _, err := session.Get(site.URL + "/page?q=1").Do(); err != nil {
+			t.Fatalf("Case %d: got unexpected error: %v", i, err)
+		}
+	}
+}
+
+func TestSession_RequestNotModified(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-CSRF-Token", "secret")
+		r.ParseForm()
+		w.Write([]byte(r.Header.Get("X-Sess") + "|" + r.PostForm.Get("csrf") + "|" + r.Header.Get("Referer")))
+	}))
+	defer ts.Close()
+
+	session := New().NewSession().
+		SetHeader("X-Sess", "1").
+		CSRF(CSRFFromHeader("X-CSRF-Token"), "", "csrf")
+
+	if _, _, err := session.Get(ts.URL + "/page").Do(); err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	req := session.Post(ts.URL+"/form").SendParam("a", "1")
+	results, err := New().DoAllFailFast([]*Request{req}, 1)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	if expected := "1|secret|" + ts.URL + "/page"; results[0].Body != expected {
+		t.Errorf("Expected: %s, got: %s", expected, results[0].Body)
+	}
+
+	// Данные сессии подставляются в http.Request, сам Request не изменяется
+	if len(req.headers) != 0 {
+		t.Errorf("Session headers should not be written to the request, got: %v", req.headers)
+	}
+
+	if _, ok := req.formData["csrf"]; ok || len(req.formData) != 1 {
+		t.Errorf("CSRF field should not be written to the request, got: %v", req.formData)
+	}
+}
+
+func TestCSRFExtractors(t *testing.T) {
+	resp := &http.Response{Header: http.Header{}}
+	resp.Header.Add("Set-Cookie", "XSRF-TOKEN=a%2Bb; Path=/")
+	resp.Header.Set("X-CSRF-Token", "header")
+
+	cases := []struct {
+		name      string
+		extractor CSRFExtractor
+		body      string
+		expected  string
+	}{
+		{"cookie", CSRFFromCookie("XSRF-TOKEN"), "", "a+b"},
+		{"header", CSRFFromHeader("X-CSRF-Token"), "", "header"},
+		{"input", CSRFFromHTML("token"), `<input value='v1' name="token"/>`, "v1"},
+		{"meta", CSRFFromHTML("token"), `<META content="v2" name=token>`, "v2"},
+		{"other", CSRFFromHTML("token"), `<input name="other" value="v3">`, ""},
+	}
+
+	for _, c := range cases {
+		if got := c.extractor(resp, c.body); got != c.expected {
+			t.Errorf("%s: expected: %s, got: %s", c.name, c.expected, got)
+		}
+	}
+}
@@ -16,3 +16,13 @@ func mapToUrlValues(data map[string][]string) url.Values {
 
 	return url.Values(data)
 }
+
+// countWriter Считает количество записанных в него байт
+type countWriter struct {
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
@@ -2,70 +2,280 @@ package webclient
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"net/url"
+	"sync"
 )
 
-// Webclient Базовя структура, содержащая http.client и http.Transport (в том числе их инициализация)
+var (
+	// ErrInvalidProxy Некорректный адрес прокси
+	ErrInvalidProxy = errors.New("webclient: invalid proxy URL")
+	// ErrTransportNotSupported Настройка применима только к *http.Transport, а у клиента другой транспорт
+	ErrTransportNotSupported = errors.New("webclient: transport is not *http.Transport")
+)
+
+// Webclient Базовя структура, содержащая http.Client и транспорт (в том числе их инициализация).
+// Webclient безопасен для одновременного использования из нескольких горутин: после создания его настройки
+// не изменяются, а With, Proxy и Dialer возвращают новый клиент. Request же предназначен для одного запроса
+// и не должен использоваться из нескольких горутин
 type Webclient struct {
-	transport *http.Transport
+	config Config
+	// Транспорт, поверх которого строится цепочка транспортов клиента (кэш, ограничения запросов и т.д.)
+	transport http.RoundTripper
 	client    *http.Client
+	// Цепочка транспортов (nil, если она не нужна). Общая для клиентов, созданных через With,
+	// в том числе с другим транспортом: он передается цепочке через контекст запроса
+	chain   http.RoundTripper
+	breaker *circuitBreaker
+	// Транспорты с прокси, общие для клиентов, созданных через With
+	proxies *proxyTransports
+	// Заголовки, устанавливаемые во все запросы клиента (WithHeader, WithBasicAuth)
+	headers map[string]string
 }
 
 // Get Отправить запрос методом GET
 func (w *Webclient) Get(url string) *Request {
-	return NewRequest(w.client, w.transport, url, http.MethodGet)
+	return w.newRequest(url, http.MethodGet)
 }
 
 // Post Отправить запрос методом POST
 func (w *Webclient) Post(url string) *Request {
-	return NewRequest(w.client, w.transport, url, http.MethodPost)
+	return w.newRequest(url, http.MethodPost)
 }
 
 // Head Отправить запрос методом HEAD
 func (w *Webclient) Head(url string) *Request {
-	return NewRequest(w.client, w.transport, url, http.MethodHead)
+	return w.newRequest(url, http.MethodHead)
 }
 
 // Put Отправить запрос методом PUT
 func (w *Webclient) Put(url string) *Request {
-	return NewRequest(w.client, w.transport, url, http.MethodPut)
+	return w.newRequest(url, http.MethodPut)
 }
 
 // Delete Отправить запрос методом DELETE
 func (w *Webclient) Delete(url string) *Request {
-	return NewRequest(w.client, w.transport, url, http.MethodDelete)
+	return w.newRequest(url, http.MethodDelete)
 }
 
 // Patch Отправить запрос методом PATCH
 func (w *Webclient) Patch(url string) *Request {
-	return NewRequest(w.client, w.transport, url, http.MethodPatch)
+	return w.newRequest(url, http.MethodPatch)
 }
 
 // Options Отправить запрос методом OPTIONS
 func (w *Webclient) Options(url string) *Request {
-	return NewRequest(w.client, w.transport, url, http.MethodOptions)
+	return w.newRequest(url, http.MethodOptions)
 }
 
-// Proxy Установить прокси для запросов
+// newRequest Создает Request с заголовками клиента по умолчанию
+func (w *Webclient) newRequest(url string, method string) *Request {
+	req := newRequest(w.client, url, method)
+	for key, value := range w.headers {
+		req.headers[key] = value
+	}
+
+	return req
+}
+
+// Proxy Возвращает новый клиент, отправляющий запросы через прокси.
+//
+// Несовместимое изменение: раньше Proxy изменял сам клиент, теперь исходный клиент НЕ изменяется,
+// и вызов client.Proxy(p) без использования результата больше не включает прокси.
+// Ошибки (некорректный адрес, транспорт не *http.Transport) только записываются в лог.
+//
+// Deprecated: используйте ProxyClient, который возвращает ошибку
 func (w *Webclient) Proxy(proxyURL string) *Webclient {
-	p, err := url.Parse(proxyURL)
+	return w.With(WithProxy(proxyURL))
+}
+
+// ProxyClient Возвращает новый клиент, отправляющий запросы через прокси. Исходный клиент не изменяется.
+// Возвращает ErrInvalidProxy для некорректного адреса и ErrTransportNotSupported,
+// если транспорт клиента не *http.Transport
+func (w *Webclient) ProxyClient(proxyURL string) (*Webclient, error) {
+	var err error
+
+	derived := w.With(func(w *Webclient) {
+		err = w.setProxy(proxyURL)
+	})
 	if err != nil {
-		log.Println("Cant parse proxy URL")
-		return w
+		return nil, err
 	}
 
-	w.transport.Proxy = http.ProxyURL(p)
-
-	return w
+	return derived, nil
 }
 
+// Dialer Возвращает новый клиент, устанавливающий соединения через dialer.
+// Действует, только если транспорт клиента - *http.Transport.
+//
+// Несовместимое изменение: раньше Dialer изменял сам клиент, теперь исходный клиент НЕ изменяется,
+// и вызов client.Dialer(d) без использования результата больше ничего не делает.
+//
+// Deprecated: используйте With(WithDialer(dialer)). Название метода создает впечатление,
+// что он настраивает сам клиент, хотя результат нужно использовать вместо него
 func (w *Webclient) Dialer(dialer func(string, string) (net.Conn, error)) *Webclient {
-	w.transport.DialContext = func(ctx context.Context, network, addr string) (conn net.Conn, e error) {
+	return w.With(WithDialer(func(ctx context.Context, network string, addr string) (net.Conn, error) {
 		return dialer(network, addr)
+	}))
+}
+
+// CloseIdleConnections Закрывает неиспользуемые соединения транспорта клиента (если транспорт это поддерживает).
+// Нужен для клиентов, созданных с WithDialer, WithTLS и т.д., которые больше не используются:
+// у каждого из них собственный пул соединений
+func (w *Webclient) CloseIdleConnections() {
+	if closer, ok := w.transport.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
 	}
+}
+
+// updateTransport Заменяет транспорт его копией, измененной fn (исходный транспорт может использоваться
+// другими клиентами). Цепочка транспортов остается прежней: куки (Jar), хранилище кэша, ограничения частоты,
+// одновременных запросов и circuit breaker общие с клиентом, от которого создан этот
+func (w *Webclient) updateTransport(fn func(transport *http.Transport)) {
+	current, ok := w.transport.(*http.Transport)
+	if !ok {
+		log.Println("Transport is not *http.Transport, option is ignored")
+		return
+	}
+
+	transport := current.Clone()
+	fn(transport)
+
+	w.setTransport(transport)
+}
+
+// setProxy Заменяет транспорт копией с прокси proxyURL (общей для клиентов, созданных через With)
+func (w *Webclient) setProxy(proxyURL string) error {
+	p, err := url.Parse(proxyURL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidProxy, err)
+	}
+
+	if len(p.Scheme) == 0 || len(p.Host) == 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidProxy, proxyURL)
+	}
+
+	current, ok := w.transport.(*http.Transport)
+	if !ok {
+		return fmt.Errorf("%w: proxy %s is not applied", ErrTransportNotSupported, p.Redacted())
+	}
+
+	w.setTransport(w.proxies.get(current, p))
+
+	return nil
+}
+
+// setTransport Заменяет транспорт, поверх которого работает цепочка транспортов клиента, не перестраивая ее
+func (w *Webclient) setTransport(transport http.RoundTripper) {
+	w.transport = transport
+
+	switch {
+	case w.client.Transport == nil:
+		// Цепочка будет построена заново поверх нового транспорта
+	case w.chain == nil:
+		w.client.Transport = transport
+	default:
+		w.client.Transport = &withBaseTransport{chain: w.chain, base: transport}
+	}
+}
+
+// baseTransportKey Ключ контекста запроса с транспортом, которым цепочка выполняет запрос
+type baseTransportKey struct{}
 
-	return w
-}
\ No newline at end of file
+// baseTransport Последнее звено цепочки транспортов: выполняет запрос транспортом из контекста запроса
+// (см. withBaseTransport), а если он не задан - транспортом, для которого цепочка построена
+type baseTransport struct {
+	fallback http.RoundTripper
+}
+
+func (t *baseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if base, ok := req.Context().Value(baseTransportKey{}).(http.RoundTripper); ok {
+		return base.RoundTrip(req)
+	}
+
+	return t.fallback.RoundTrip(req)
+}
+
+// withBaseTransport Выполняет запрос общей цепочкой транспортов поверх другого транспорта
+type withBaseTransport struct {
+	chain http.RoundTripper
+	base  http.RoundTripper
+}
+
+func (t *withBaseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.chain.RoundTrip(req.WithContext(context.WithValue(req.Context(), baseTransportKey{}, t.base)))
+}
+
+// proxyTransports Копии транспортов с прокси. Повторные WithProxy с тем же прокси используют одну копию
+// и ее пул соединений, а не создают новый пул при каждом вызове
+type proxyTransports struct {
+	mu         sync.Mutex
+	transports map[proxyTransportKey]*http.Transport
+}
+
+// proxyTransportKey Исходный транспорт и адрес прокси
+type proxyTransportKey struct {
+	base  *http.Transport
+	proxy string
+}
+
+// get Возвращает копию base с прокси proxyURL
+func (p *proxyTransports) get(base *http.Transport, proxyURL *url.URL) *http.Transport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := proxyTransportKey{base: base, proxy: proxyURL.String()}
+	if transport, ok := p.transports[key]; ok {
+		return transport
+	}
+
+	transport := base.Clone()
+	transport.Proxy = http.ProxyURL(proxyURL)
+	p.transports[key] = transport
+
+	return transport
+}
+
+// updateConfig Изменяет настройки цепочки транспортов и сбрасывает ее, чтобы она была построена заново
+func (w *Webclient) updateConfig(fn func(config *Config)) {
+	fn(&w.config)
+	w.client.Transport = nil
+}
+
+// clone Создает копию клиента с собственными http.Client и заголовками, но общей цепочкой транспортов
+func (w *Webclient) clone() *Webclient {
+	client := *w.client
+	derived := *w
+	derived.client = &client
+
+	derived.headers = make(map[string]string, len(w.headers))
+	for key, value := range w.headers {
+		derived.headers[key] = value
+	}
+
+	return &derived
+}
+
+// HTTPClient Возвращает http.Client клиента (его Transport - вся цепочка транспортов: кэш, ограничения запросов и т.д.).
+// Клиент используется одновременно многими запросами и не должен изменяться, для изменения настроек используйте With
+func (w *Webclient) HTTPClient() *http.Client {
+	return w.client
+}
+
+// Transport Возвращает транспорт, поверх которого строится цепочка транспортов клиента
+func (w *Webclient) Transport() http.RoundTripper {
+	return w.transport
+}
+
+// CircuitState Возвращает состояние circuit breaker для хоста (без порта). Без Config.CircuitBreaker всегда CircuitClosed
+func (w *Webclient) CircuitState(host string) CircuitState {
+	if w.breaker == nil {
+		return CircuitClosed
+	}
+
+	return w.breaker.State(host)
+}
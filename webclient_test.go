@@ -4,13 +4,26 @@ package webclient
 // todo: проверять на urlencode, пробелы, пустые параметры
 
 import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
+	"io"
 	"io/ioutil"
+	"mime"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -267,9 +280,15 @@ func TestMultipartFile(t *testing.T) {
 				t.Errorf("Unexpected body of request")
 			}
 
+			// Content-Type определяется по расширению README.md или по содержимому
+			expected := mime.TypeByExtension(".md")
+			if len(expected) == 0 {
+				expected = "text/plain; charset=utf-8"
+			}
+
 			ct := r.MultipartForm.File["userfile"][0].Header.Get("Content-Type")
-			if ct != "application/octet-stream" {
-				t.Errorf("Expected content type of file: %s, got: %s", "application/octet-stream", ct)
+			if ct != expected {
+				t.Errorf("Expected content type of file: %s, got: %s", expected, ct)
 			}
 		case case02_custom_file:
 			f := r.MultipartForm.File["userfile"][0]
@@ -533,3 +552,878 @@ func TestUrlencode(t *testing.T) {
 	Config{}.New().Get(ts.URL+case01_mget).QueryParam("name[1]", "'va l ueЩ").Do()
 	Config{}.New().Post(ts.URL+case02_mpost).SendParam("name[1]", "'va l ueЩ").Do()
 }
+
+func TestQueryMerge(t *testing.T) {
+	const case01_keep = "/keep"
+	const case02_append = "/append"
+	const case03_replace = "/replace"
+	const case04_order = "/order"
+	const case05_query_order = "/query-order"
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+
+		switch r.URL.Path {
+		case case01_keep:
+			if r.URL.RawQuery != "b=2&a=1" {
+				t.Errorf("Expected raw query: %s, got: %s", "b=2&a=1", r.URL.RawQuery)
+			}
+		case case02_append:
+			if strings.Join(params["a"], ",") != "1,3" {
+				t.Errorf("Expected values of a: %s, got: %v", "1,3", params["a"])
+			}
+
+			if params.Get("b") != "2" {
+				t.Errorf("Expected query param. Expected: %s, got: %s", "2", params.Get("b"))
+			}
+		case case03_replace:
+			if strings.Join(params["a"], ",") != "3" {
+				t.Errorf("Expected values of a: %s, got: %v", "3", params["a"])
+			}
+
+			if params.Get("b") != "2" {
+				t.Errorf("Expected query param. Expected: %s, got: %s", "2", params.Get("b"))
+			}
+		case case04_order:
+			if r.URL.RawQuery != "z=1&b=2&y=%D0%A9&c=3" {
+				t.Errorf("Expected raw query: %s, got: %s", "z=1&b=2&y=%D0%A9&c=3", r.URL.RawQuery)
+			}
+		case case05_query_order:
+			if r.URL.RawQuery != "z=1&b=1&a=2&a=4&c=3&d=+" {
+				t.Errorf("Expected raw query: %s, got: %s", "z=1&b=1&a=2&a=4&c=3&d=+", r.URL.RawQuery)
+			}
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	}))
+
+	defer ts.Close()
+
+	client := Config{}.New()
+	client.Get(ts.URL + case01_keep + "?b=2&a=1").Do()
+	client.Get(ts.URL+case02_append+"?a=1&b=2").QueryParam("a", "3").Do()
+	client.Get(ts.URL+case03_replace+"?a=1&b=2").QueryMerge(QueryReplace).QueryParam("a", "3").Do()
+	client.Get(ts.URL+case04_order+"?z=1&b=2").KeepQueryOrder(true).QueryParam("y", "Щ").QueryParam("c", "3").Do()
+
+	// Параметры из Query добавляются в порядке первого появления ключа в строке
+	for i := 0; i < 10; i++ {
+		client.Get(ts.URL + case05_query_order + "?z=1").KeepQueryOrder(true).Query("b=1&a=2&c=3&a=4&d=+").Do()
+	}
+}
+
+func TestMultipartStream(t *testing.T) {
+	const case01_sized = "/sized"
+	const case02_unsized = "/unsized"
+
+	content := strings.Repeat("0123456789", 100000)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case case01_sized:
+			if r.ContentLength <= int64(len(content)) {
+				t.Errorf("Expected known Content-Length, got: %d", r.ContentLength)
+			}
+		case case02_unsized:
+			if r.ContentLength != -1 {
+				t.Errorf("Expected unknown Content-Length, got: %d", r.ContentLength)
+			}
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+
+		if err := r.ParseMultipartForm(4096); err != nil {
+			t.Errorf("Got unexpected error: %v", err)
+			return
+		}
+
+		if r.MultipartForm.Value["s1"][0] != "a" {
+			t.Errorf("Unexpected body of request")
+		}
+
+		fh := r.MultipartForm.File["userfile"][0]
+		f, _ := fh.Open()
+		defer f.Close()
+
+		d, _ := ioutil.ReadAll(f)
+		if string(d) != content {
+			t.Errorf("Unexpected file content, length: %d", len(d))
+		}
+	}))
+
+	defer ts.Close()
+
+	client := Config{}.New()
+	client.Post(ts.URL+case01_sized).
+		SendParam("s1", "a").
+		SendFile(NewFileReader(strings.NewReader(content), "big.bin", "userfile", int64(len(content)))).
+		Do()
+
+	client.Post(ts.URL+case02_unsized).
+		SendParam("s1", "a").
+		SendFile(NewFileReader(strings.NewReader(content), "big.bin", "userfile", 0)).
+		Do()
+}
+
+func TestProgress(t *testing.T) {
+	content := strings.Repeat("0123456789", 10000)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Write([]byte(content))
+	}))
+
+	defer ts.Close()
+
+	var sent, sentTotal, received, receivedTotal int64
+
+	_, body, err := Config{}.New().Post(ts.URL).
+		SendPlain(content).
+		OnUploadProgress(func(current int64, total int64) { sent, sentTotal = current, total }).
+		OnDownloadProgress(func(current int64, total int64) { received, receivedTotal = current, total }).
+		ProgressInterval(time.Second).
+		Do()
+	if err != nil {
+		t.Errorf("Got unexpected error: %v", err)
+	}
+
+	if body != content {
+		t.Errorf("Unexpected body, length: %d", len(body))
+	}
+
+	if sent != int64(len(content)) || sentTotal != int64(len(content)) {
+		t.Errorf("Unexpected upload progress: %d/%d", sent, sentTotal)
+	}
+
+	if received != int64(len(content)) || receivedTotal != int64(len(content)) {
+		t.Errorf("Unexpected download progress: %d/%d", received, receivedTotal)
+	}
+}
+
+func TestFileContentType(t *testing.T) {
+	png := "\x89PNG\x0D\x0A\x1A\x0A" + strings.Repeat("\x00", 600)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseMultipartForm(4096)
+
+		expected := map[string]string{
+			"ext":      "application/json",
+			"sniff":    "image/png",
+			"data":     "text/plain; charset=utf-8",
+			"explicit": "application/x-custom",
+		}
+
+		for param, ctype := range expected {
+			files := r.MultipartForm.File[param]
+			if len(files) == 0 {
+				t.Errorf("Expected file in param: %s", param)
+				continue
+			}
+
+			if files[0].Header.Get("Content-Type") != ctype {
+				t.Errorf("Expected content type of file %s: %s, got: %s", param, ctype, files[0].Header.Get("Content-Type"))
+			}
+		}
+
+		f, _ := r.MultipartForm.File["sniff"][0].Open()
+		defer f.Close()
+
+		d, _ := ioutil.ReadAll(f)
+		if string(d) != png {
+			t.Errorf("Sniffed file content was damaged, length: %d", len(d))
+		}
+	}))
+
+	defer ts.Close()
+
+	Config{}.New().Post(ts.URL).
+		SendFile(File{Name: "data.json", Param: "ext", Data: []byte("{}")}).
+		SendFile(NewFileReader(strings.NewReader(png), "image", "sniff", 0)).
+		SendFile(File{Name: "noext", Param: "data", Data: []byte("plain text")}).
+		SendFile(File{Name: "data.json", Param: "explicit", Data: []byte("{}"), ContentType: "application/x-custom"}).
+		Do()
+}
+
+func TestRequest_SendBytes(t *testing.T) {
+	const case01_bytes = "/bytes"
+	const case02_reader = "/reader"
+
+	payload := []byte{0x00, 0xff, 0x10, 0x00, 'a'}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d, _ := ioutil.ReadAll(r.Body)
+		if string(d) != string(payload) {
+			t.Errorf("Unexpected body: %v", d)
+		}
+
+		if r.ContentLength != int64(len(payload)) {
+			t.Errorf("Expected Content-Length: %d, got: %d", len(payload), r.ContentLength)
+		}
+
+		switch r.URL.Path {
+		case case01_bytes:
+			if r.Header.Get("Content-Type") != "image/png" {
+				t.Errorf("Expect header content-type: %s, got: %s", "image/png", r.Header.Get("Content-Type"))
+			}
+		case case02_reader:
+			if r.Header.Get("Content-Type") != string(TypeOctetStream) {
+				t.Errorf("Expect header content-type: %s, got: %s", TypeOctetStream, r.Header.Get("Content-Type"))
+			}
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	}))
+
+	defer ts.Close()
+
+	client := Config{}.New()
+	client.Put(ts.URL + case01_bytes).ContentType("image/png").SendBytes(payload).Do()
+	client.Put(ts.URL+case02_reader).SendReader(bytes.NewBuffer(payload), int64(len(payload))).Do()
+}
+
+func TestCodec(t *testing.T) {
+	const case01_custom = "/custom"
+	const case02_result = "/result"
+
+	// Простейший кодек: "name=<Name>"
+	RegisterCodec("application/x-test", NewCodec(
+		func(v interface{}) ([]byte, error) {
+			return []byte("name=" + v.(*Person).Name), nil
+		},
+		func(data []byte, v interface{}) error {
+			v.(*Person).Name = strings.TrimPrefix(string(data), "name=")
+			return nil
+		},
+	))
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case case01_custom:
+			d, _ := ioutil.ReadAll(r.Body)
+			if string(d) != "name=foo" {
+				t.Errorf("Expected body: %s, got: %s", "name=foo", string(d))
+			}
+
+			w.Header().Set("Content-Type", "application/x-test; charset=utf-8")
+			w.Write([]byte("name=bar"))
+		case case02_result:
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.Write([]byte(`{"name":"baz","pets":[{"id":1,"age":2}]}`))
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	}))
+
+	defer ts.Close()
+
+	var p1 Person
+	_, _, err := Config{}.New().Post(ts.URL + case01_custom).
+		ContentType("application/x-test").
+		SendStruct(&Person{Name: "foo"}).
+		Result(&p1).
+		Do()
+	if err != nil {
+		t.Errorf("Got unexpected error: %v", err)
+	}
+
+	if p1.Name != "bar" {
+		t.Errorf("Expected: %s, got: %s", "bar", p1.Name)
+	}
+
+	var p2 Person
+	_, _, err = Config{}.New().Get(ts.URL + case02_result).Result(&p2).Do()
+	if err != nil {
+		t.Errorf("Got unexpected error: %v", err)
+	}
+
+	if p2.Name != "baz" || len(p2.Pets) != 1 {
+		t.Errorf("Unexpected result: %+v", p2)
+	}
+
+	_, _, err = Config{}.New().Post(ts.URL + case01_custom).ContentType(TypeCBOR).SendStruct(&p1).Do()
+	if !errors.Is(err, ErrCodecNotFound) {
+		t.Errorf("Expected error: %v, got: %v", ErrCodecNotFound, err)
+	}
+}
+
+// testProto Сообщение, совместимое с ProtoMessage и умеющее сериализовать себя (как в gogo/protobuf)
+type testProto struct {
+	Value []byte
+}
+
+func (m *testProto) Reset()         { m.Value = nil }
+func (m *testProto) String() string { return string(m.Value) }
+func (m *testProto) ProtoMessage()  {}
+
+func (m *testProto) Marshal() ([]byte, error) {
+	return append([]byte{0x0a, byte(len(m.Value))}, m.Value...), nil
+}
+
+func (m *testProto) Unmarshal(data []byte) error {
+	if len(data) < 2 || int(data[1]) != len(data)-2 {
+		return errors.New("bad message")
+	}
+
+	m.Value = data[2:]
+	return nil
+}
+
+func TestRequest_SendProto(t *testing.T) {
+	const case01_binary = "/binary"
+	const case02_json = "/json"
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d, _ := ioutil.ReadAll(r.Body)
+
+		switch r.URL.Path {
+		case case01_binary:
+			if r.Header.Get("Content-Type") != string(TypeProtobuf) {
+				t.Errorf("Expect header content-type: %s, got: %s", TypeProtobuf, r.Header.Get("Content-Type"))
+			}
+
+			if !bytes.Equal(d, []byte{0x0a, 0x02, 0x00, 0xff}) {
+				t.Errorf("Unexpected body: %v", d)
+			}
+
+			w.Header().Set("Content-Type", string(TypeProtobuf))
+			w.Write([]byte{0x0a, 0x01, 0x80})
+		case case02_json:
+			if r.Method != http.MethodGet {
+				t.Errorf("Message without proto codec for JSON should not be sent")
+			}
+
+			w.Header().Set("Content-Type", string(TypeJSON))
+			w.Write([]byte(`{"value":"AP8="}`))
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	}))
+
+	defer ts.Close()
+
+	var result testProto
+	_, _, err := Config{}.New().Post(ts.URL + case01_binary).
+		SendProto(&testProto{Value: []byte{0x00, 0xff}}).
+		Result(&result).
+		Do()
+	if err != nil {
+		t.Errorf("Got unexpected error: %v", err)
+	}
+
+	if !bytes.Equal(result.Value, []byte{0x80}) {
+		t.Errorf("Unexpected result: %v", result.Value)
+	}
+
+	// Без RegisterProtoCodec(TypeJSON, ...) encoding/json не используется: его результат не соответствует JSON-маппингу protobuf
+	_, _, err = Config{}.New().Post(ts.URL + case02_json).
+		SendProto(&testProto{Value: []byte{0x00, 0xff}}).
+		ContentType(TypeJSON).
+		Do()
+	if !errors.Is(err, ErrCodecNotFound) {
+		t.Errorf("Expected error: %v, got: %v", ErrCodecNotFound, err)
+	}
+
+	_, _, err = Config{}.New().Get(ts.URL + case02_json).Result(&result).Do()
+	if !errors.Is(err, ErrCodecNotFound) {
+		t.Errorf("Expected error: %v, got: %v", ErrCodecNotFound, err)
+	}
+}
+
+func TestRequest_Compress(t *testing.T) {
+	const case01_gzip = "/gzip"
+	const case02_deflate = "/deflate"
+	const case03_small = "/small"
+
+	content := strings.Repeat(`{"id":1,"name":"foo"},`, 1000)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			body io.Reader
+			err  error
+		)
+
+		switch r.URL.Path {
+		case case01_gzip:
+			body, err = gzip.NewReader(r.Body)
+		case case02_deflate:
+			body, err = zlib.NewReader(r.Body)
+		case case03_small:
+			body = r.Body
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+			return
+		}
+
+		if err != nil {
+			t.Errorf("Got unexpected error: %v", err)
+			return
+		}
+
+		expected := strings.TrimPrefix(r.URL.Path, "/")
+		if expected == "small" {
+			expected = ""
+		}
+
+		if r.Header.Get("Content-Encoding") != expected {
+			t.Errorf("Expected Content-Encoding: %s, got: %s", expected, r.Header.Get("Content-Encoding"))
+		}
+
+		d, _ := ioutil.ReadAll(body)
+		if string(d) != content && string(d) != "small" {
+			t.Errorf("Unexpected body, length: %d", len(d))
+		}
+	}))
+
+	defer ts.Close()
+
+	client := Config{}.New()
+	client.Post(ts.URL + case01_gzip).SendJSON(content).Compress("gzip").CompressThreshold(1024).Do()
+	client.Post(ts.URL + case02_deflate).SendJSON(content).Compress("deflate").Do()
+	client.Post(ts.URL + case03_small).SendPlain("small").Compress("gzip").CompressThreshold(1024).Do()
+
+	_, _, err := client.Post(ts.URL + case01_gzip).SendJSON(content).Compress("unknown").Do()
+	if !errors.Is(err, ErrUnsupportedEncoding) {
+		t.Errorf("Expected error: %v, got: %v", ErrUnsupportedEncoding, err)
+	}
+}
+
+func TestResponseDecompress(t *testing.T) {
+	const content = "decompressed content"
+
+	RegisterDecoder("b64", func(r io.Reader) (io.ReadCloser, error) {
+		return ioutil.NopCloser(base64.NewDecoder(base64.StdEncoding, r)), nil
+	})
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept := r.Header.Get("Accept-Encoding")
+
+		switch r.URL.Path {
+		case "/gzip":
+			if !strings.Contains(accept, "gzip") {
+				t.Errorf("Expected gzip in Accept-Encoding, got: %s", accept)
+			}
+
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			gz.Write([]byte(content))
+			gz.Close()
+		case "/raw-deflate":
+			w.Header().Set("Content-Encoding", "deflate")
+			fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+			fw.Write([]byte(content))
+			fw.Close()
+		case "/custom":
+			if !strings.Contains(accept, "b64") {
+				t.Errorf("Expected b64 in Accept-Encoding, got: %s", accept)
+			}
+
+			w.Header().Set("Content-Encoding", "gzip, b64")
+			buf := &bytes.Buffer{}
+			gz := gzip.NewWriter(buf)
+			gz.Write([]byte(content))
+			gz.Close()
+			w.Write([]byte(base64.StdEncoding.EncodeToString(buf.Bytes())))
+		case "/plain":
+			w.Write([]byte(content))
+		case "/truncated":
+			w.Header().Set("Content-Encoding", "gzip")
+			buf := &bytes.Buffer{}
+			gz := gzip.NewWriter(buf)
+			gz.Write([]byte(content))
+			gz.Close()
+			w.Write(buf.Bytes()[:buf.Len()/2])
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	}))
+
+	defer ts.Close()
+
+	client := Config{}.New()
+
+	for _, path := range []string{"/gzip", "/raw-deflate", "/custom", "/plain"} {
+		resp, body, err := client.Get(ts.URL + path).Do()
+		if err != nil {
+			t.Errorf("Got unexpected error: %v", err)
+			continue
+		}
+
+		if body != content {
+			t.Errorf("Unexpected body for %s: %q", path, body)
+		}
+
+		if len(resp.Header.Get("Content-Encoding")) > 0 {
+			t.Errorf("Content-Encoding should be removed after decompression")
+		}
+	}
+
+	// Ошибка распаковки возвращается из Do, а не дает пустое тело
+	if _, _, err := client.Get(ts.URL + "/truncated").Do(); err == nil {
+		t.Errorf("Expected error for truncated gzip body")
+	}
+
+	// Accept-Encoding, установленный вручную, не мешает распаковке
+	_, body, _ := client.Get(ts.URL+"/gzip").SetHeader("Accept-Encoding", "gzip").Do()
+	if body != content {
+		t.Errorf("Unexpected body: %q", body)
+	}
+
+	// RawEncoding запрашивает сжатие как обычно, но не распаковывает ответ
+	resp, body, _ := client.Get(ts.URL + "/gzip").RawEncoding(true).Do()
+	if resp.Header.Get("Content-Encoding") != "gzip" || !strings.HasPrefix(body, "\x1f\x8b") {
+		t.Errorf("Expected raw gzip body, got: %q", body)
+	}
+}
+
+func TestConditional(t *testing.T) {
+	const etag = `"v2"`
+	modified := time.Date(2020, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+
+		switch r.Method {
+		case http.MethodGet:
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+
+			if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modified.After(since) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case http.MethodPut:
+			if match := r.Header.Get("If-Match"); len(match) > 0 && match != etag {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+
+			if since, err := http.ParseTime(r.Header.Get("If-Unmodified-Since")); err == nil && modified.After(since) {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+		}
+
+		w.Write([]byte("ok"))
+	}))
+
+	defer ts.Close()
+
+	client := Config{}.New()
+
+	resp, _, err := client.Get(ts.URL).Do()
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	if ResponseETag(resp) != etag {
+		t.Errorf("Expected ETag: %s, got: %s", etag, ResponseETag(resp))
+	}
+
+	if lm, err := ResponseLastModified(resp); err != nil || !lm.Equal(modified) {
+		t.Errorf("Expected Last-Modified: %v, got: %v (%v)", modified, lm, err)
+	}
+
+	cases := []struct {
+		req      *Request
+		expected error
+	}{
+		{client.Get(ts.URL).IfNoneMatch(etag), ErrNotModified},
+		{client.Get(ts.URL).IfNoneMatch(`"v1"`), nil},
+		{client.Get(ts.URL).IfModifiedSince(modified), ErrNotModified},
+		{client.Put(ts.URL).IfMatch(etag), nil},
+		{client.Put(ts.URL).IfMatch(`"v1"`), ErrPreconditionFailed},
+		{client.Put(ts.URL).IfUnmodifiedSince(modified.Add(-time.Hour)), ErrPreconditionFailed},
+	}
+
+	for i, c := range cases {
+		if _, _, err := c.req.Do(); err != c.expected {
+			t.Errorf("Case %d: expected error: %v, got: %v", i, c.expected, err)
+		}
+	}
+}
+
+func TestConcurrentUse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer ts.Close()
+
+	var proxied int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&proxied, 1)
+		w.Write([]byte("proxy"))
+	}))
+	defer proxy.Close()
+
+	client := Config{UseKeepAlive: true, RateLimit: RateLimit{RPS: 10000, Burst: 100}}.New()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			path := "/" + strconv.Itoa(i)
+
+			if _, body, err := client.Get(ts.URL + path).Do(); err != nil || body != path {
+				t.Errorf("Expected: %s, got: %s (%v)", path, body, err)
+			}
+
+			if _, body, err := NewRequest(client.client, client.transport, ts.URL+path, http.MethodGet).Do(); err != nil || body != path {
+				t.Errorf("Expected: %s, got: %s (%v)", path, body, err)
+			}
+
+			derived := client.Proxy(proxy.URL).Dialer(net.Dial)
+			if _, body, err := derived.Get(ts.URL + path).Do(); err != nil || body != "proxy" {
+				t.Errorf("Expected: %s, got: %s (%v)", "proxy", body, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&proxied); n != 20 {
+		t.Errorf("Expected: %d proxied requests, got: %d", 20, n)
+	}
+
+	// Исходный клиент не изменился
+	if _, body, err := client.Get(ts.URL + "/direct").Do(); err != nil || body != "/direct" {
+		t.Errorf("Expected: %s, got: %s (%v)", "/direct", body, err)
+	}
+
+	if client.transport.(*http.Transport).Proxy != nil {
+		t.Errorf("Proxy should not modify the original client")
+	}
+}
+
+func TestWebclient_With(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redirect":
+			http.Redirect(w, r, "/headers", http.StatusFound)
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		default:
+			w.Write([]byte(r.Header.Get("X-Team") + "|" + r.Header.Get("Authorization")))
+		}
+	}))
+	defer ts.Close()
+
+	client := Config{FollowRedirect: true}.New()
+	derived := client.With(
+		WithHeader("X-Team", "search"),
+		WithBasicAuth("user", "pass"),
+		WithTimeout(50*time.Millisecond),
+		WithFollowRedirect(false),
+	)
+
+	auth := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass"))
+
+	if _, body, _ := derived.Get(ts.URL + "/headers").Do(); body != "search|"+auth {
+		t.Errorf("Expected: %s, got: %s", "search|"+auth, body)
+	}
+
+	if _, body, _ := derived.Get(ts.URL+"/headers").SetHeader("X-Team", "ads").Do(); body != "ads|"+auth {
+		t.Errorf("Request headers should override client headers, got: %s", body)
+	}
+
+	if resp, _, _ := derived.Get(ts.URL + "/redirect").Do(); resp.StatusCode != http.StatusFound {
+		t.Errorf("Expected: %d, got: %d", http.StatusFound, resp.StatusCode)
+	}
+
+	if _, _, err := derived.Get(ts.URL + "/slow").Do(); err == nil {
+		t.Errorf("Expected timeout error")
+	}
+
+	// Исходный клиент не изменился
+	if _, body, _ := client.Get(ts.URL + "/redirect").Do(); body != "|" {
+		t.Errorf("Expected: %s, got: %s", "|", body)
+	}
+
+	if _, _, err := client.Get(ts.URL + "/slow").Do(); err != nil {
+		t.Errorf("Got unexpected error: %v", err)
+	}
+
+	if derived.client.Transport != client.client.Transport {
+		t.Errorf("Derived client should share transport with the original")
+	}
+}
+
+func TestWebclient_WithProxy(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("proxy"))
+	}))
+	defer proxy.Close()
+
+	client := Config{RateLimit: RateLimit{RPS: 5, Burst: 1}, MaxConcurrent: 1, BulkheadFailFast: true}.New()
+
+	// Клиент с прокси использует тот же пул соединений при повторных вызовах
+	derived, err := client.ProxyClient(proxy.URL)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	if derived.Transport() != client.With(WithProxy(proxy.URL)).Transport() {
+		t.Errorf("Clients with the same proxy should share transport")
+	}
+
+	if derived.Transport() == client.Transport() {
+		t.Errorf("WithProxy should not modify the original transport")
+	}
+
+	resp, err := client.Get(ts.URL).Stream()
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	// Клиент с прокси разделяет ограничения одновременных запросов и частоты с исходным
+	if _, _, err := derived.Get(ts.URL).Do(); !errors.Is(err, ErrBulkheadFull) {
+		t.Errorf("Expected error: %v, got: %v", ErrBulkheadFull, err)
+	}
+	resp.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, _, err := derived.Get(ts.URL).WithContext(ctx).Do(); err == nil {
+		t.Errorf("Rate limit should be shared with the original client")
+	}
+
+	if _, body, err := derived.Get(ts.URL).Do(); err != nil || body != "proxy" {
+		t.Errorf("Expected: %s, got: %s (%v)", "proxy", body, err)
+	}
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestNew(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	// По умолчанию сертификат проверяется
+	if _, _, err := New().Get(ts.URL).Do(); err == nil {
+		t.Errorf("Expected certificate error")
+	}
+
+	if _, body, err := New(WithTLS(&tls.Config{InsecureSkipVerify: true})).Get(ts.URL).Do(); err != nil || body != "ok" {
+		t.Errorf("Expected: %s, got: %s (%v)", "ok", body, err)
+	}
+
+	// Config.New сохраняет прежнее поведение
+	if _, body, err := (Config{}).New().Get(ts.URL).Do(); err != nil || body != "ok" {
+		t.Errorf("Expected: %s, got: %s (%v)", "ok", body, err)
+	}
+
+	var calls int32
+	recorder := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&calls, 1)
+		return ts.Client().Transport.RoundTrip(req)
+	})
+
+	client := New(WithTransport(recorder), WithRateLimit(RateLimit{RPS: 1000}))
+	if _, body, err := client.Get(ts.URL).Do(); err != nil || body != "ok" {
+		t.Errorf("Expected: %s, got: %s (%v)", "ok", body, err)
+	}
+
+	httpClient := &http.Client{Transport: recorder, Timeout: time.Second}
+	client = New(WithHTTPClient(httpClient))
+	if _, body, err := client.Get(ts.URL).Do(); err != nil || body != "ok" {
+		t.Errorf("Expected: %s, got: %s (%v)", "ok", body, err)
+	}
+
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("Expected: %d requests through custom transport, got: %d", 2, n)
+	}
+
+	if client.client.Timeout != time.Second || client.client == httpClient {
+		t.Errorf("WithHTTPClient should copy client settings without modifying it")
+	}
+}
+
+func TestWebclient_Transport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	var calls int32
+	recorder := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&calls, 1)
+		return http.DefaultTransport.RoundTrip(req)
+	})
+
+	client := New(WithTransport(recorder), WithCache(NewMemoryCache(1<<20)))
+	if _, ok := client.Transport().(roundTripperFunc); !ok {
+		t.Errorf("Transport should return the transport from WithTransport")
+	}
+
+	// Клиент из HTTPClient выполняет запросы через всю цепочку транспортов
+	resp, err := client.HTTPClient().Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if status := ResponseCacheStatus(resp); status != CacheMiss {
+		t.Errorf("Expected: %s, got: %s", CacheMiss, status)
+	}
+
+	// NewRequest принимает любой http.RoundTripper и не изменяет клиент
+	httpClient := &http.Client{}
+	if _, body, err := NewRequest(httpClient, recorder, ts.URL, http.MethodGet).Do(); err != nil || body != "ok" {
+		t.Errorf("Expected: %s, got: %s (%v)", "ok", body, err)
+	}
+
+	if httpClient.Transport != nil {
+		t.Errorf("NewRequest should not modify the client")
+	}
+
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("Expected: %d requests through custom transport, got: %d", 2, n)
+	}
+
+	// Прокси не применим к произвольному транспорту: ProxyClient сообщает об этом ошибкой
+	if _, err := client.ProxyClient("http://127.0.0.1:1"); !errors.Is(err, ErrTransportNotSupported) {
+		t.Errorf("Expected error: %v, got: %v", ErrTransportNotSupported, err)
+	}
+
+	if _, err := New().ProxyClient("127.0.0.1:1"); !errors.Is(err, ErrInvalidProxy) {
+		t.Errorf("Expected error: %v, got: %v", ErrInvalidProxy, err)
+	}
+
+	if derived := client.Proxy("http://127.0.0.1:1"); derived.Transport() == nil {
+		t.Errorf("Proxy should keep the custom transport")
+	}
+}
+
+func TestNewFile(t *testing.T) {
+	if _, err := NewFile(".", "userfile"); !errors.Is(err, ErrNotRegularFile) {
+		t.Errorf("Expected error: %v, got: %v", ErrNotRegularFile, err)
+	}
+
+	if _, err := NewFile("./not-exists.txt", "userfile"); err == nil {
+		t.Errorf("Expected error for missing file")
+	}
+
+	f, err := NewFile("./README.md", "userfile")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	if f.Name != "README.md" || f.Path != "./README.md" || f.Size <= 0 || f.Data != nil {
+		t.Errorf("Unexpected file: %+v", f)
+	}
+}